@@ -7,4 +7,4 @@ require (
 	github.com/gorilla/websocket v1.5.0
 )
 
-require github.com/mitchellh/mapstructure v1.5.0 // indirect
+require github.com/mitchellh/mapstructure v1.5.0
@@ -1,16 +1,116 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"example.com/chess-server/pkg"
 )
 
 func main() {
-	server := pkg.NewServer([]pkg.Handler{
-		pkg.NewQueueManager(),
-		pkg.NewMatchMaker(10 * time.Second),
-		pkg.NewGameManager(),
+	config, err := pkg.ParseConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := pkg.NewLogger(os.Stderr, config.LogLevel)
+
+	bus := pkg.NewBus()
+	bus.SetLogger(logger.With("component", "bus"))
+
+	games := pkg.NewGameManager(bus)
+	games.SetLogger(logger.With("component", "games"))
+	games.SetTimeouts(config.Timeouts)
+	games.SetChatLimit(config.RateLimits.Chat)
+
+	// e.g. /usr/games/stockfish, played as "stockfish"
+	if config.UCIEngine != "" {
+		games.RegisterEngine(filepath.Base(config.UCIEngine), config.UCIEngine)
+	}
+
+	// correspondence games and games suspended on shutdown
+	// are kept on disk between restarts
+	store, err := pkg.NewFileStore(filepath.Join(config.StoragePath, "games"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	games.SetStore(store)
+
+	if config.AuditLog != "" {
+		audit, err := pkg.OpenAuditLog(config.AuditLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer audit.Close()
+
+		games.SetAudit(audit)
+	}
+
+	if err := games.Restore(); err != nil {
+		log.Fatal(err)
+	}
+
+	queues := pkg.NewQueueManager(bus)
+	queues.SetCatalog(config.TimeControls)
+	queues.SetLogger(logger.With("component", "queues"))
+
+	matches := pkg.NewMatchMaker(bus, time.Duration(config.Timeouts.Match))
+	matches.SetLogger(logger.With("component", "matches"))
+
+	server := pkg.NewServer(bus, []pkg.Handler{
+		queues,
+		matches,
+		games,
+		pkg.NewChallengeManager(bus, time.Duration(config.Timeouts.Challenge)),
 	})
-	server.Listen("0.0.0.0:8080")
+	server.SetOrigins(config.Origins)
+	server.SetMessageLimits(config.RateLimits.Messages, config.RateLimits.Addresses)
+	server.SetConnectionLimits(config.Connections)
+	server.SetLogger(logger.With("component", "server"))
+
+	// the token is best kept out of the config file, in CHESS_ADMIN_TOKEN
+	if config.AdminToken != "" {
+		admin := pkg.NewAdmin(config.AdminToken, server, queues, matches, games)
+		admin.SetLogger(logger.With("component", "admin"))
+		server.Handle(admin)
+	}
+
+	for name, token := range config.BotTokens {
+		server.Accounts().Add(name, token)
+	}
+
+	go func() {
+		var err error
+
+		if config.TLS.Cert != "" {
+			err = server.ListenTLS(config.Listen, config.TLS.Cert, config.TLS.Key)
+		} else {
+			err = server.Listen(config.Listen)
+		}
+
+		if err != nil {
+			logger.Error("Listening failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	logger.Info("Listening", "addr", config.Listen, "tls", config.TLS.Cert != "")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	// players get this long to finish their games
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeouts.Shutdown))
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Shutdown failed", "error", err)
+	}
 }
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Namespace for bot ids so they stay the same across restarts
+var BotNamespace = uuid.MustParse("0b5c1bd2-3f0e-4a5b-9b43-6f1f0c6a8e21")
+
+// Account of a third-party program playing through the socket
+type BotAccount struct {
+	Id    uuid.UUID
+	Name  string
+	Token string
+}
+
+type Accounts struct {
+	mutex  *sync.Mutex
+	tokens map[string]*BotAccount
+}
+
+func NewAccounts() *Accounts {
+	return &Accounts{
+		mutex:  new(sync.Mutex),
+		tokens: make(map[string]*BotAccount),
+	}
+}
+
+// Add a bot account with a known token
+func (a *Accounts) Add(name, token string) *BotAccount {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	account := &BotAccount{
+		Id:    uuid.NewSHA1(BotNamespace, []byte(name)),
+		Name:  name,
+		Token: token,
+	}
+	a.tokens[token] = account
+
+	return account
+}
+
+// Random secret, hex encoded
+func NewToken() (string, error) {
+	bytes := make([]byte, 32)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// Create a bot account with a random token
+func (a *Accounts) Register(name string) (*BotAccount, error) {
+	token, err := NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Add(name, token), nil
+}
+
+// Bot account with the given id, nil if there's none
+func (a *Accounts) Find(id uuid.UUID) *BotAccount {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, account := range a.tokens {
+		if account.Id == id {
+			return account
+		}
+	}
+
+	return nil
+}
+
+func (a *Accounts) Authenticate(token string) *BotAccount {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.tokens[token]
+}
+
+// Bot account of the request's bearer token, nil for humans
+// who don't send one
+func (a *Accounts) FromRequest(r *http.Request) (*BotAccount, error) {
+	header := r.Header.Get("Authorization")
+
+	if header == "" {
+		return nil, nil
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	account := a.Authenticate(token)
+
+	if token == header || account == nil {
+		return nil, errors.New("Invalid token")
+	}
+
+	return account, nil
+}
@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticatesBots(t *testing.T) {
+	accounts := NewAccounts()
+	account, err := accounts.Register("engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accounts.Add("engine", "other").Id != account.Id {
+		t.Error("Expected id to depend on the name only")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if bot, err := accounts.FromRequest(req); bot != nil || err != nil {
+		t.Errorf("Expected humans to connect without token, got %v %v", bot, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+account.Token)
+	if bot, err := accounts.FromRequest(req); err != nil || bot.Name != "engine" {
+		t.Errorf("Expected bot account, got %v %v", bot, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, err := accounts.FromRequest(req); err == nil {
+		t.Error("Expected invalid token to be rejected")
+	}
+}
@@ -0,0 +1,407 @@
+package pkg
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How long bans and mutes last when no duration is given
+const DEFAULT_BAN = 24 * time.Hour
+
+type AdminPlayer struct {
+	Id      uuid.UUID `json:"id"`
+	Bot     bool      `json:"bot"`
+	Rating  int       `json:"rating"`
+	Addr    string    `json:"addr"`
+	Latency int64     `json:"latency"`
+	Muted   bool      `json:"muted"`
+}
+
+type AdminGame struct {
+	Summary GameSummary       `json:"summary"`
+	State   GameStateResponse `json:"state"`
+	Chat    []ChatLine        `json:"chat"`
+}
+
+// No winner ends the game without a result
+type EndGameParams struct {
+	Winner Color  `json:"winner"`
+	Reason string `json:"reason"`
+}
+
+type FlushParams struct {
+	Queue   string `json:"queue"`
+	Variant string `json:"variant"`
+	Bots    bool   `json:"bots"`
+}
+
+type BanParams struct {
+	PlayerId uuid.UUID `json:"player_id"`
+	Duration Duration  `json:"duration"`
+	Reason   string    `json:"reason"`
+}
+
+type MuteParams struct {
+	PlayerId uuid.UUID `json:"player_id"`
+	Duration Duration  `json:"duration"`
+}
+
+type AnnounceParams struct {
+	Text string `json:"text"`
+}
+
+// Admin serves the moderation and operations API under /admin/,
+// requests need the token as a bearer token
+type Admin struct {
+	token   string
+	server  *Server
+	queues  *QueueManager
+	matches *MatchMaker
+	games   *GameManager
+	logger  *Logger
+	mutex   *sync.Mutex
+}
+
+func NewAdmin(token string, server *Server, queues *QueueManager, matches *MatchMaker, games *GameManager) *Admin {
+	return &Admin{
+		token:   token,
+		server:  server,
+		queues:  queues,
+		matches: matches,
+		games:   games,
+		mutex:   new(sync.Mutex),
+	}
+}
+
+func (a *Admin) SetLogger(logger *Logger) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.logger = logger
+}
+
+func (a *Admin) log() *Logger {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.logger
+}
+
+func (a *Admin) Routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/admin/players":      a.authorized(a.ServePlayers),
+		"/admin/games/":       a.authorized(a.ServeGame),
+		"/admin/matches":      a.authorized(a.ServeMatches),
+		"/admin/matches/":     a.authorized(a.ServeMatch),
+		"/admin/queues/flush": a.authorized(a.ServeFlush),
+		"/admin/bans":         a.authorized(a.ServeBans),
+		"/admin/mutes":        a.authorized(a.ServeMutes),
+		"/admin/announce":     a.authorized(a.ServeAnnounce),
+	}
+}
+
+func (a *Admin) authorized(route http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + a.token)
+		given := []byte(r.Header.Get("Authorization"))
+
+		if a.token == "" || subtle.ConstantTimeCompare(given, expected) != 1 {
+			a.log().Warn("Unauthorized admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		route(w, r)
+	}
+}
+
+// GET /admin/players
+func (a *Admin) ServePlayers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	players := []AdminPlayer{}
+
+	for _, player := range a.server.Players() {
+		players = append(players, AdminPlayer{
+			Id:      player.Id,
+			Bot:     player.Bot,
+			Rating:  player.Rating,
+			Addr:    player.Addr(),
+			Latency: player.Latency().Milliseconds(),
+			Muted:   player.IsMuted(),
+		})
+	}
+
+	writeJSON(w, players)
+}
+
+// GET /admin/games/{id} and POST /admin/games/{id}/end
+func (a *Admin) ServeGame(w http.ResponseWriter, r *http.Request) {
+	gameId, action, err := parsePath(r.URL.Path, "/admin/games/")
+	if err != nil {
+		http.Error(w, "Invalid game id", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		game := a.games.FindGame(gameId)
+		if game == nil {
+			http.Error(w, "Game not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, AdminGame{
+			Summary: game.Summary(),
+			State:   game.State(),
+			Chat:    game.ChatHistory(),
+		})
+
+	case "end":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		var params EndGameParams
+		if !readJSON(w, r, &params) {
+			return
+		}
+
+		if params.Reason == "" {
+			params.Reason = "Adjudication"
+		}
+
+		if err := a.games.EndGame(gameId, params.Winner, params.Reason); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GET /admin/matches
+func (a *Admin) ServeMatches(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	writeJSON(w, a.matches.ListMatches())
+}
+
+// POST /admin/matches/{id}/cancel
+func (a *Admin) ServeMatch(w http.ResponseWriter, r *http.Request) {
+	matchId, action, err := parsePath(r.URL.Path, "/admin/matches/")
+	if err != nil || action != "cancel" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if !a.matches.CancelMatch(matchId) {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	a.log().Info("Match canceled", "match_id", matchId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /admin/queues/flush
+func (a *Admin) ServeFlush(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var params FlushParams
+	if !readJSON(w, r, &params) {
+		return
+	}
+
+	players, err := a.queues.Flush(params.Queue, params.Variant, params.Bots)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	a.log().Info("Queue flushed", "queue", params.Queue, "variant", params.Variant, "bots", params.Bots, "players", PlayerIds(players))
+	writeJSON(w, PlayerIds(players))
+}
+
+// GET, POST and DELETE /admin/bans
+func (a *Admin) ServeBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, a.server.Bans())
+
+	case http.MethodPost:
+		var params BanParams
+		if !readJSON(w, r, &params) {
+			return
+		}
+
+		if params.Duration <= 0 {
+			params.Duration = Duration(DEFAULT_BAN)
+		}
+
+		ban, err := a.server.Ban(params.PlayerId, time.Duration(params.Duration), params.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		a.log().Info("Player banned", "player_id", ban.PlayerId, "addr", ban.Addr, "until", ban.Until, "reason", ban.Reason)
+		writeJSON(w, ban)
+
+	case http.MethodDelete:
+		playerId, err := uuid.Parse(r.URL.Query().Get("player_id"))
+		if err != nil {
+			http.Error(w, "Invalid player id", http.StatusBadRequest)
+			return
+		}
+
+		if !a.server.Unban(playerId) {
+			http.Error(w, "Player not banned", http.StatusNotFound)
+			return
+		}
+
+		a.log().Info("Player unbanned", "player_id", playerId)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		allowMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// POST and DELETE /admin/mutes, for connected players
+func (a *Admin) ServeMutes(w http.ResponseWriter, r *http.Request) {
+	var playerId uuid.UUID
+	var duration Duration
+
+	switch r.Method {
+	case http.MethodPost:
+		var params MuteParams
+		if !readJSON(w, r, &params) {
+			return
+		}
+
+		playerId = params.PlayerId
+		duration = params.Duration
+
+		if duration <= 0 {
+			duration = Duration(DEFAULT_BAN)
+		}
+
+	case http.MethodDelete:
+		id, err := uuid.Parse(r.URL.Query().Get("player_id"))
+		if err != nil {
+			http.Error(w, "Invalid player id", http.StatusBadRequest)
+			return
+		}
+
+		playerId = id
+
+	default:
+		allowMethod(w, r, http.MethodPost, http.MethodDelete)
+		return
+	}
+
+	player := a.server.FindPlayer(playerId)
+	if player == nil {
+		http.Error(w, "Player not connected", http.StatusNotFound)
+		return
+	}
+
+	if duration > 0 {
+		player.Mute(time.Duration(duration))
+		a.log().Info("Player muted", "player_id", playerId, "duration", time.Duration(duration))
+	} else {
+		player.Unmute()
+		a.log().Info("Player unmuted", "player_id", playerId)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /admin/announce
+func (a *Admin) ServeAnnounce(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var params AnnounceParams
+	if !readJSON(w, r, &params) {
+		return
+	}
+
+	if strings.TrimSpace(params.Text) == "" {
+		http.Error(w, "Empty announcement", http.StatusBadRequest)
+		return
+	}
+
+	a.server.Announce(params.Text)
+
+	a.log().Info("Announcement sent", "text", params.Text)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Id and action of paths like /admin/games/{id}/end
+func parsePath(path, prefix string) (uuid.UUID, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, prefix), "/", 2)
+
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	if len(parts) == 1 {
+		return id, "", nil
+	}
+
+	return id, parts[1], nil
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	return false
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, params interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
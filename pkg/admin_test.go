@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func NewTestAdmin() (*Admin, *QueueManager, *GameManager) {
+	bus := NewBus()
+	queues := NewQueueManager(bus)
+	matches := NewMatchMaker(bus, time.Second)
+	games := NewGameManager(bus)
+	server := NewServer(bus, []Handler{queues, matches, games})
+
+	return NewAdmin("secret", server, queues, matches, games), queues, games
+}
+
+func adminRequest(admin *Admin, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	admin.Routes()[routePattern(path)](recorder, request)
+
+	return recorder
+}
+
+// Pattern of Routes serving path, as the mux would pick it
+func routePattern(path string) string {
+	for _, prefix := range []string{"/admin/games/", "/admin/matches/"} {
+		if strings.HasPrefix(path, prefix) {
+			return prefix
+		}
+	}
+
+	return strings.SplitN(path, "?", 2)[0]
+}
+
+func TestAdminNeedsToken(t *testing.T) {
+	admin, _, _ := NewTestAdmin()
+
+	for _, header := range []string{"", "Bearer guessed", "secret"} {
+		request := httptest.NewRequest("GET", "/admin/players", nil)
+		request.Header.Set("Authorization", header)
+
+		recorder := httptest.NewRecorder()
+		admin.Routes()["/admin/players"](recorder, request)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be unauthorized, got %v", header, recorder.Code)
+		}
+	}
+
+	if res := adminRequest(admin, "GET", "/admin/players", ""); res.Code != http.StatusOK {
+		t.Errorf("Expected players with the token, got %v", res.Code)
+	}
+}
+
+func TestAdminEndsGame(t *testing.T) {
+	admin, _, games := NewTestAdmin()
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go games.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "5m", Increment: "0s"},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	gameId := res.Payload.(GameStart).GameId
+	path := "/admin/games/" + gameId.String()
+
+	inspected := adminRequest(admin, "GET", path, "")
+
+	var game AdminGame
+	json.Unmarshal(inspected.Body.Bytes(), &game)
+
+	if game.Summary.GameId != gameId || game.Summary.White.Id != p1.Id {
+		t.Errorf("Expected the game, got %+v", game)
+	}
+
+	go adminRequest(admin, "POST", path+"/end", `{"winner": "black", "reason": "Fair play violation"}`)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-p1.Outgoing:
+			if result := res.Payload.(GameOverResponse); result.Winner || result.Reason != "Fair play violation" {
+				t.Errorf("Expected white to lose, got %+v", result)
+			}
+		case res := <-p2.Outgoing:
+			if result := res.Payload.(GameOverResponse); !result.Winner {
+				t.Errorf("Expected black to win, got %+v", result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected game over, got timeout instead")
+		}
+	}
+
+	if res := adminRequest(admin, "POST", path+"/end", `{"winner": "white"}`); res.Code != http.StatusNotFound {
+		t.Errorf("Expected game to be gone, got %v", res.Code)
+	}
+}
+
+func TestAdminFlushesQueue(t *testing.T) {
+	admin, queues, _ := NewTestAdmin()
+	player := NewTestPlayer()
+
+	go queues.Process(Message{
+		Type:    QueueUp,
+		Player:  player,
+		Payload: map[string]interface{}{"queue": "5+0 Blitz"},
+	})
+	<-player.Outgoing
+
+	res := adminRequest(admin, "POST", "/admin/queues/flush", `{"queue": "5+0 Blitz"}`)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), player.Id.String()) {
+		t.Errorf("Expected player to be flushed, got %v %v", res.Code, res.Body.String())
+	}
+
+	if response := <-player.Outgoing; response.Type != QueueFlushed {
+		t.Errorf("Expected player to be told, got %v", response.Type)
+	}
+
+	for _, queue := range queues.ListQueues() {
+		if queue.Waiting != 0 {
+			t.Errorf("Expected empty queues, got %+v", queue)
+		}
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	admin, _, _ := NewTestAdmin()
+	account := admin.server.Accounts().Add("engine", "token")
+
+	res := adminRequest(admin, "POST", "/admin/bans", `{"player_id": "`+account.Id.String()+`", "duration": "1h"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected ban, got %v", res.Code)
+	}
+
+	if !admin.server.IsBanned("192.0.2.1", account) {
+		t.Error("Expected account to be banned")
+	}
+
+	adminRequest(admin, "DELETE", "/admin/bans?player_id="+account.Id.String(), "")
+
+	if admin.server.IsBanned("192.0.2.1", account) {
+		t.Error("Expected ban to be lifted")
+	}
+
+	guest := uuid.New()
+
+	res = adminRequest(admin, "POST", "/admin/bans", `{"player_id": "`+guest.String()+`"}`)
+	if res.Code != http.StatusNotFound {
+		t.Errorf("Expected a guest who left not to be banned, got %v", res.Code)
+	}
+
+	if len(admin.server.Bans()) != 0 {
+		t.Errorf("Expected no bans, got %v", admin.server.Bans())
+	}
+}
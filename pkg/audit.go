@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Entry of the audit log, either a move or a game result
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	GameId uuid.UUID `json:"game_id"`
+
+	// moves
+	PlayerId *uuid.UUID `json:"player_id,omitempty"`
+	Color    Color      `json:"color,omitempty"`
+	Move     string     `json:"move,omitempty"`
+	Clock    int64      `json:"clock,omitempty"`
+
+	// results
+	Winner *uuid.UUID `json:"winner,omitempty"`
+	Loser  *uuid.UUID `json:"loser,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	Moves  []string   `json:"moves,omitempty"`
+}
+
+// AuditLog appends every accepted move and every game result
+// as JSON lines, to settle disputes after the fact. A nil audit
+// log records nothing.
+type AuditLog struct {
+	out   io.Writer
+	mutex *sync.Mutex
+}
+
+func NewAuditLog(out io.Writer) *AuditLog {
+	return &AuditLog{
+		out:   out,
+		mutex: new(sync.Mutex),
+	}
+}
+
+// Append to the file at path, creating it if needed
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuditLog(file), nil
+}
+
+// Move played by player, with the time they had left in move.Time
+func (a *AuditLog) Move(game *Game, player *GamePlayer, move MoveResponse) error {
+	if a == nil {
+		return nil
+	}
+
+	notation := move.From + move.To
+	if move.Drop != "" {
+		notation = move.Drop + "@" + move.To
+	}
+
+	return a.write(AuditRecord{
+		Event:    "move",
+		GameId:   game.Id,
+		PlayerId: &player.Player.Id,
+		Color:    player.Color,
+		Move:     notation,
+		Clock:    move.Time,
+	})
+}
+
+func (a *AuditLog) Result(game *Game, result GameResult) error {
+	if a == nil {
+		return nil
+	}
+
+	record := AuditRecord{
+		Event:  "result",
+		GameId: game.Id,
+		Reason: result.Reason,
+		Moves:  game.Moves(),
+	}
+
+	if result.Winner != nil {
+		record.Winner = &result.Winner.Id
+	}
+	if result.Loser != nil {
+		record.Loser = &result.Loser.Id
+	}
+
+	return a.write(record)
+}
+
+func (a *AuditLog) write(record AuditRecord) error {
+	record.Time = time.Now().UTC()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, err = a.out.Write(append(data, '\n'))
+	return err
+}
+
+// Close the underlying file, if any
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	if closer, ok := a.out.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
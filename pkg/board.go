@@ -3,6 +3,7 @@ package pkg
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"sync"
@@ -126,60 +127,139 @@ func (r *Range) Next() Square {
 }
 
 type Board struct {
-	mutex  *sync.Mutex
-	matrix [8]map[rune]Piece
+	mutex   *sync.Mutex
+	matrix  [8]map[rune]Piece
+	variant Variant
 }
 
+const (
+	Standard = "standard"
+	Chess960 = "chess960"
+)
+
+// Back rank of the standard starting position
+const STANDARD_RANK = "RNBQKBNR"
+
 func NewBoard() *Board {
-	return &Board{
-		mutex: new(sync.Mutex),
-		matrix: [8]map[rune]Piece{
-			{
-				'a': Rook(White),
-				'b': Knight(White),
-				'c': Bishop(White),
-				'd': Queen(White),
-				'e': King(White),
-				'f': Bishop(White),
-				'g': Knight(White),
-				'h': Rook(White),
-			},
-			{
-				'a': Pawn(White),
-				'b': Pawn(White),
-				'c': Pawn(White),
-				'd': Pawn(White),
-				'e': Pawn(White),
-				'f': Pawn(White),
-				'g': Pawn(White),
-				'h': Pawn(White),
-			},
-			{'a': Empty(), 'b': Empty(), 'c': Empty(), 'd': Empty(), 'e': Empty(), 'f': Empty(), 'g': Empty(), 'h': Empty()},
-			{'a': Empty(), 'b': Empty(), 'c': Empty(), 'd': Empty(), 'e': Empty(), 'f': Empty(), 'g': Empty(), 'h': Empty()},
-			{'a': Empty(), 'b': Empty(), 'c': Empty(), 'd': Empty(), 'e': Empty(), 'f': Empty(), 'g': Empty(), 'h': Empty()},
-			{'a': Empty(), 'b': Empty(), 'c': Empty(), 'd': Empty(), 'e': Empty(), 'f': Empty(), 'g': Empty(), 'h': Empty()},
-			{
-				'a': Pawn(Black),
-				'b': Pawn(Black),
-				'c': Pawn(Black),
-				'd': Pawn(Black),
-				'e': Pawn(Black),
-				'f': Pawn(Black),
-				'g': Pawn(Black),
-				'h': Pawn(Black),
-			},
-			{
-				'a': Rook(Black),
-				'b': Knight(Black),
-				'c': Bishop(Black),
-				'd': Queen(Black),
-				'e': King(Black),
-				'f': Bishop(Black),
-				'g': Knight(Black),
-				'h': Rook(Black),
-			},
-		},
+	return NewBoardFromRank(STANDARD_RANK)
+}
+
+// Create a board with both sides' back ranks mirroring rank,
+// which lists the pieces from the a to the h file, e.g. RNBQKBNR
+func NewBoardFromRank(rank string) *Board {
+	board := &Board{
+		mutex:   new(sync.Mutex),
+		variant: StandardChess{},
+	}
+
+	for row := 0; row < 8; row++ {
+		board.matrix[row] = make(map[rune]Piece)
+
+		for col := 'a'; col <= 'h'; col++ {
+			board.matrix[row][col] = Empty()
+		}
+	}
+
+	king := rune('a' + strings.Index(rank, "K"))
+	queenRook := rune('a' + strings.Index(rank, "R"))
+	kingRook := rune('a' + strings.LastIndex(rank, "R"))
+
+	for i, notation := range rank {
+		col := rune('a' + i)
+
+		for _, color := range []Color{White, Black} {
+			row := 0
+			pawns := 1
+
+			if color == Black {
+				row = 7
+				pawns = 6
+			}
+
+			piece := PieceFromNotation(notation, color)
+
+			if notation == 'K' {
+				piece = CastlingKing(color, king, queenRook, kingRook)
+			}
+
+			board.matrix[row][col] = piece
+			board.matrix[pawns][col] = Pawn(color)
+		}
+	}
+
+	return board
+}
+
+// Random Chess960 back rank, bishops on opposite colors
+// and the king somewhere between the rooks
+func RandomRank() string {
+	rank := make([]rune, 8)
+
+	rank[rand.Intn(4)*2] = 'B'
+	rank[rand.Intn(4)*2+1] = 'B'
+
+	place := func(piece rune) {
+		empty := []int{}
+		for i, square := range rank {
+			if square == 0 {
+				empty = append(empty, i)
+			}
+		}
+		rank[empty[rand.Intn(len(empty))]] = piece
+	}
+
+	place('Q')
+	place('N')
+	place('N')
+
+	remaining := []rune{'R', 'K', 'R'}
+	for i, square := range rank {
+		if square == 0 {
+			rank[i] = remaining[0]
+			remaining = remaining[1:]
+		}
+	}
+
+	return string(rank)
+}
+
+// Rules the board is played under
+func (b *Board) Variant() Variant {
+	return b.variant
+}
+
+// White's back rank from the a to the h file, e.g. RNBQKBNR
+func (b *Board) Rank() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	rank := ""
+	for col := 'a'; col <= 'h'; col++ {
+		rank += strings.ToUpper(b.matrix[0][col].Notation)
+	}
+
+	return rank
+}
+
+// Copy of the board to try moves on without touching the original
+func (b *Board) Clone() *Board {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	board := &Board{
+		mutex:   new(sync.Mutex),
+		variant: b.variant.Clone(),
+	}
+
+	for row := 0; row < 8; row++ {
+		board.matrix[row] = make(map[rune]Piece, 8)
+
+		for col, piece := range b.matrix[row] {
+			board.matrix[row][col] = piece
+		}
 	}
+
+	return board
 }
 
 func (b *Board) Square(square string) Piece {
@@ -190,6 +270,66 @@ func (b *Board) Square(square string) Piece {
 	return b.matrix[s.row][s.col]
 }
 
+// FEN returns the piece placement field of the board in
+// Forsyth-Edwards Notation
+func (b *Board) FEN() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ranks := []string{}
+
+	for row := 7; row >= 0; row-- {
+		rank := ""
+		empty := 0
+
+		for col := 'a'; col <= 'h'; col++ {
+			piece := b.matrix[row][col]
+
+			if piece == Empty() {
+				empty++
+				continue
+			}
+
+			if empty > 0 {
+				rank += strconv.Itoa(empty)
+				empty = 0
+			}
+
+			if piece.Color == White {
+				rank += strings.ToUpper(piece.Notation)
+			} else {
+				rank += strings.ToLower(piece.Notation)
+			}
+		}
+
+		if empty > 0 {
+			rank += strconv.Itoa(empty)
+		}
+
+		ranks = append(ranks, rank)
+	}
+
+	return strings.Join(ranks, "/")
+}
+
+// Square the king of the given color is on
+func (b *Board) KingSquare(color Color) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for row := 0; row < 8; row++ {
+		for col := 'a'; col <= 'h'; col++ {
+			piece := b.matrix[row][col]
+
+			if piece.king && piece.Color == color {
+				return Square{col: col, row: row}.String()
+			}
+		}
+	}
+
+	return ""
+}
+
 func (b *Board) CanBlock(threats []Range, color Color) bool {
 	for _, threat := range threats {
 		for !threat.Done() {
@@ -236,13 +376,27 @@ func (b *Board) Move(from, to string) []AllowedMove {
 	piece := b.Square(from)
 	moves := piece.Move(from, to, b)
 
-	if len(moves) > 0 {
-		for _, move := range moves {
-			pieceToMove := b.Square(move.From.String())
+	if len(moves) > 0 && b.variant.IsAllowed(b, moves) {
+		captured := b.matrix[moves[0].To.row][moves[0].To.col]
+		if captured.Color == piece.Color {
+			captured = Empty()
+		}
+
+		// pick up every piece before putting them down since in
+		// Chess960 the king may land where the rook started
+		pieces := []Piece{}
 
-			b.matrix[move.To.row][move.To.col] = pieceToMove
+		for _, move := range moves {
+			pieces = append(pieces, b.matrix[move.From.row][move.From.col])
 			b.matrix[move.From.row][move.From.col] = Empty()
 		}
+
+		for i, move := range moves {
+			b.matrix[move.To.row][move.To.col] = pieces[i]
+		}
+
+		b.variant.AfterMove(b, piece.Color, moves, captured)
+
 		return moves
 	}
 
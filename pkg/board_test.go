@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -242,3 +243,86 @@ func TestForwardCaptureDiagonally(t *testing.T) {
 		t.Error("Should capture d1 from c2")
 	}
 }
+
+func TestFEN(t *testing.T) {
+	board := NewBoard()
+
+	if board.FEN() != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR" {
+		t.Errorf("Expected initial position, got %v", board.FEN())
+	}
+
+	board.Move("e2", "e4")
+	board.Move("g8", "f6")
+
+	if board.FEN() != "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPP1PPP/RNBQKBNR" {
+		t.Errorf("Expected e4 Nf6 position, got %v", board.FEN())
+	}
+}
+
+func TestRandomRank(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		rank := RandomRank()
+
+		bishop := strings.Index(rank, "B")
+		otherBishop := strings.LastIndex(rank, "B")
+
+		if bishop%2 == otherBishop%2 {
+			t.Fatalf("Expected bishops on opposite colors, got %v", rank)
+		}
+
+		king := strings.Index(rank, "K")
+		if king < strings.Index(rank, "R") || king > strings.LastIndex(rank, "R") {
+			t.Fatalf("Expected king between rooks, got %v", rank)
+		}
+
+		if strings.Count(rank, "Q") != 1 || strings.Count(rank, "N") != 2 {
+			t.Fatalf("Expected one queen and two knights, got %v", rank)
+		}
+	}
+}
+
+func TestBoardFromRank(t *testing.T) {
+	board := NewBoardFromRank("NNRKRBBQ")
+
+	if board.FEN() != "nnrkrbbq/pppppppp/8/8/8/8/PPPPPPPP/NNRKRBBQ" {
+		t.Errorf("Expected mirrored back ranks, got %v", board.FEN())
+	}
+	if board.KingSquare(White) != "d1" {
+		t.Errorf("Expected white king on d1, got %v", board.KingSquare(White))
+	}
+	if board.KingSquare(Black) != "d8" {
+		t.Errorf("Expected black king on d8, got %v", board.KingSquare(Black))
+	}
+}
+
+func TestChess960Castle(t *testing.T) {
+	board := NewBoardFromRank("NNRKRBBQ")
+
+	// king and rook swap places
+	board.Move("d1", "c1")
+
+	if !reflect.DeepEqual(board.Square("c1"), CastlingKing(White, 'd', 'c', 'e')) {
+		t.Errorf("Expected king on c1, got %v", board.Square("c1"))
+	}
+	if board.Square("d1") != Rook(White) {
+		t.Errorf("Expected rook on d1, got %v", board.Square("d1"))
+	}
+
+	board = NewBoardFromRank("NNRKRBBQ")
+	board.matrix[7]['f'] = Empty()
+	board.matrix[7]['g'] = Empty()
+	board.matrix[7]['h'] = Empty()
+
+	// king to the rook's square
+	board.Move("d8", "e8")
+
+	if !reflect.DeepEqual(board.Square("g8"), CastlingKing(Black, 'd', 'c', 'e')) {
+		t.Errorf("Expected king on g8, got %v", board.Square("g8"))
+	}
+	if board.Square("f8") != Rook(Black) {
+		t.Errorf("Expected rook on f8, got %v", board.Square("f8"))
+	}
+	if board.Square("e8") != Empty() {
+		t.Errorf("Expected e8 to be empty, got %v", board.Square("e8"))
+	}
+}
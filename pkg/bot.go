@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BotLevel struct {
+	Depth    int
+	MoveTime time.Duration
+	Rating   int
+}
+
+// Levels players may choose from, easiest first
+var BotLevels = []BotLevel{
+	{Depth: 1, MoveTime: 500 * time.Millisecond, Rating: 800},
+	{Depth: 2, MoveTime: time.Second, Rating: 1100},
+	{Depth: 3, MoveTime: 2 * time.Second, Rating: 1400},
+	{Depth: 4, MoveTime: 3 * time.Second, Rating: 1700},
+}
+
+// Time control for bot games when the player doesn't pick one
+var BOT_TIME_CONTROL = TimeControl{
+	Duration:  "10m",
+	Increment: "5s",
+}
+
+// Position the bot has to find a move in
+type Position struct {
+	Board   *Board
+	Color   Color
+	Variant string
+
+	// starting position and moves since, in UCI notation
+	Fen   string
+	Moves []string
+}
+
+// Searcher finds the moves a bot plays
+type Searcher interface {
+	BestMove(position Position) (EngineMove, bool)
+	Supports(variant string) bool
+	Close() error
+}
+
+// Settings of a bot level, starting from 1
+func GetBotLevel(level int) (BotLevel, error) {
+	if level < 1 || level > len(BotLevels) {
+		return BotLevel{}, errors.New("Invalid bot level")
+	}
+	return BotLevels[level-1], nil
+}
+
+// Bot is a player without a socket, it reads its responses
+// and answers through the dispatcher like a client would
+type Bot struct {
+	*Player
+
+	bus      *Bus
+	searcher Searcher
+	gameId   uuid.UUID
+	color    Color
+	board    *Board
+	variant  string
+	fen      string
+	moves    []string
+
+	// second half of castling moves already on the board
+	pending []AllowedMove
+}
+
+// Moves are published to bus
+func NewBot(bus *Bus, searcher Searcher, rating int) *Bot {
+	bot := &Bot{
+		Player: &Player{
+			Id:     uuid.New(),
+			Rating: rating,
+			Bot:    true,
+
+			Incoming: make(chan Message),
+			Outgoing: make(chan Response),
+
+			colors: []Color{},
+			mutex:  new(sync.Mutex),
+		},
+		bus:      bus,
+		searcher: searcher,
+	}
+
+	go bot.Play()
+
+	return bot
+}
+
+// Play games until one is over
+func (b *Bot) Play() {
+	defer b.searcher.Close()
+
+	for response := range b.Outgoing {
+		switch response.Type {
+		case StartGame:
+			b.Start(response.Payload.(GameStart))
+
+			if b.color == White {
+				b.Think()
+			}
+		case StartTurn:
+			if b.Opponent(response.Payload.(MoveResponse)) {
+				b.Think()
+			}
+		case GameOver:
+			b.bus.Publish(Message{
+				Type:   Disconnected,
+				Player: b.Player,
+			})
+			go b.discard()
+			return
+		}
+	}
+}
+
+// Drop what's still sent to the bot after its game, so senders
+// don't block, until nothing came for a while
+func (b *Bot) discard() {
+	for {
+		select {
+		case <-b.Outgoing:
+		case <-time.After(CLOSE_TIMEOUT):
+			return
+		}
+	}
+}
+
+// Set up the starting position, pieces are still on their
+// initial squares so the first rank is all it takes
+func (b *Bot) Start(start GameStart) {
+	ranks := strings.Split(strings.Split(start.Fen, " ")[0], "/")
+
+	b.gameId = start.GameId
+	b.color = start.Color
+	b.variant = start.TimeControl.Variant
+	b.fen = start.Fen
+	b.moves = []string{}
+	b.pending = []AllowedMove{}
+
+	b.board = NewBoardFromRank(ranks[len(ranks)-1])
+	b.board.variant = NewVariant(b.variant)
+}
+
+// Play the opponent's move on the bot's board, returns false
+// when it only completes a move already played
+func (b *Bot) Opponent(move MoveResponse) bool {
+	if move.Drop != "" {
+		b.board.Variant().Drop(b.board, opponent(b.color), move.Drop, move.To)
+		b.moves = append(b.moves, move.Drop+"@"+move.To)
+		return true
+	}
+
+	for i, pending := range b.pending {
+		if pending.From.String() == move.From && pending.To.String() == move.To {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return false
+		}
+	}
+
+	moves := b.board.Move(move.From, move.To)
+
+	if len(moves) > 1 {
+		b.pending = moves[1:]
+
+		// Chess960 engines expect castling as the king taking the rook
+		if b.variant == Chess960 {
+			move.To = moves[1].From.String()
+		}
+	}
+
+	b.moves = append(b.moves, move.From+move.To)
+
+	return true
+}
+
+// Search a move and send it to the game
+func (b *Bot) Think() {
+	moves := make([]string, len(b.moves))
+	copy(moves, b.moves)
+
+	move, ok := b.searcher.BestMove(Position{
+		Board:   b.board.Clone(),
+		Color:   b.color,
+		Variant: b.variant,
+		Fen:     b.fen,
+		Moves:   moves,
+	})
+	if !ok {
+		return
+	}
+
+	b.board.Move(move.From, move.To)
+	b.moves = append(b.moves, move.From+move.To)
+
+	b.bus.Publish(Message{
+		Type:   Move,
+		Player: b.Player,
+		Payload: map[string]interface{}{
+			"from":    move.From,
+			"to":      move.To,
+			"game_id": b.gameId.String(),
+		},
+	})
+}
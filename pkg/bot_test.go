@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvalidBotLevel(t *testing.T) {
+	if _, err := GetBotLevel(len(BotLevels) + 1); err == nil {
+		t.Error("Expected invalid level to be rejected")
+	}
+}
+
+func TestPlayBot(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	manager := NewGameManager(bus)
+	player := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   PlayBot,
+		Player: player,
+		Payload: map[string]interface{}{
+			"level": 1,
+			"color": "white",
+		},
+	})
+
+	var params MatchParams
+
+	select {
+	case res := <-events:
+		if res.Type != CreateGame {
+			t.Fatalf("Expected create game, got %v", res.Type)
+		}
+		params = res.Payload.(MatchParams)
+	case <-time.After(time.Second):
+		t.Fatal("Expected game to be created, got timeout")
+	}
+
+	if params.Players[0] != player {
+		t.Fatal("Expected player to get white")
+	}
+	if params.TimeControl != BOT_TIME_CONTROL {
+		t.Errorf("Expected default time control, got %+v", params.TimeControl)
+	}
+
+	go manager.Process(Message{
+		Type:    CreateGame,
+		Payload: params,
+	})
+
+	start := (<-player.Outgoing).Payload.(GameStart)
+
+	go manager.Process(Message{
+		Type:   Move,
+		Player: player,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": start.GameId.String(),
+		},
+	})
+
+	select {
+	case res := <-events:
+		if res.Type != Move || res.Player != params.Players[1] {
+			t.Fatalf("Expected bot to move, got %+v", res)
+		}
+
+		go manager.Process(res)
+
+		turn := (<-player.Outgoing).Payload.(MoveResponse)
+		if turn.From == "" || turn.To == "" {
+			t.Errorf("Expected bot's move, got %+v", turn)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected bot to move, got timeout")
+	}
+}
+
+func TestNoRematchWithBots(t *testing.T) {
+	bus := NewBus()
+	manager := NewGameManager(bus)
+	player := NewTestPlayer()
+	bot := NewBot(bus, NewEngine(BotLevels[0].Depth, BotLevels[0].MoveTime), BotLevels[0].Rating)
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{player, bot.Player},
+			TimeControl: BOT_TIME_CONTROL,
+		},
+	})
+
+	start := (<-player.Outgoing).Payload.(GameStart)
+
+	go manager.Process(Message{
+		Type:    Resign,
+		Player:  player,
+		Payload: start.GameId.String(),
+	})
+
+	select {
+	case res := <-player.Outgoing:
+		if res.Type != GameOver {
+			t.Fatalf("Expected game over, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected game over, got timeout")
+	}
+
+	if manager.FindRematch(start.GameId) != nil {
+		t.Error("Expected no rematch against a bot")
+	}
+}
+
+func TestOneBotGameAtATime(t *testing.T) {
+	bus := NewBus()
+	created := bus.Listen(CreateGame)
+	manager := NewGameManager(bus)
+	player := NewTestPlayer()
+
+	playBot := func() MatchParams {
+		go manager.Process(Message{
+			Type:    PlayBot,
+			Player:  player,
+			Payload: map[string]interface{}{"color": "white"},
+		})
+
+		select {
+		case res := <-created:
+			return res.Payload.(MatchParams)
+		case <-time.After(time.Second):
+			t.Fatal("Expected game to be created, got timeout")
+		}
+
+		return MatchParams{}
+	}
+
+	params := playBot()
+
+	expectError(t, manager, Message{
+		Type:    PlayBot,
+		Player:  player,
+		Payload: map[string]interface{}{},
+	}, "Already playing a bot")
+
+	go manager.Process(Message{
+		Type:    CreateGame,
+		Payload: params,
+	})
+
+	start := (<-player.Outgoing).Payload.(GameStart)
+
+	go manager.Process(Message{
+		Type:    Resign,
+		Player:  player,
+		Payload: start.GameId.String(),
+	})
+
+	if res := <-player.Outgoing; res.Type != GameOver {
+		t.Fatalf("Expected game over, got %v", res.Type)
+	}
+
+	// the bot game is let go before players hear it's over
+	playBot()
+}
@@ -0,0 +1,209 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type Handler interface {
+	Process(event Message)
+}
+
+// Subscriber is implemented by handlers that only care about some
+// message types, handlers that don't get every message
+type Subscriber interface {
+	Topics() []MessageType
+}
+
+type subscription struct {
+	handler Handler
+	topics  map[MessageType]bool
+}
+
+func (s *subscription) Wants(event Message) bool {
+	return len(s.topics) == 0 || s.topics[event.Type]
+}
+
+// Messages waiting for a handler, in the order they were published
+type lane struct {
+	events []Message
+}
+
+// Messages a lane holds before further ones are dropped, a handler
+// that can't keep up mustn't grow the bus without bound
+const MAX_LANE_LENGTH = 1024
+
+type laneKey struct {
+	subscription *subscription
+	key          string
+}
+
+// Bus delivers published messages to the handlers subscribed to
+// their type, one at a time and in order for the same game or player
+// while handlers and unrelated games run concurrently
+type Bus struct {
+	mutex         *sync.Mutex
+	subscriptions []*subscription
+	lanes         map[laneKey]*lane
+	dropped       *CounterVec
+	logger        *Logger
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		mutex:         new(sync.Mutex),
+		subscriptions: []*subscription{},
+		lanes:         make(map[laneKey]*lane),
+		dropped:       NewCounterVec(),
+	}
+}
+
+func (b *Bus) SetLogger(logger *Logger) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.logger = logger
+}
+
+// Deliver messages of the given types to handler, every type
+// when none is given
+func (b *Bus) Subscribe(handler Handler, topics ...MessageType) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	subscription := &subscription{
+		handler: handler,
+		topics:  make(map[MessageType]bool),
+	}
+
+	for _, topic := range topics {
+		subscription.topics[topic] = true
+	}
+
+	b.subscriptions = append(b.subscriptions, subscription)
+}
+
+// Subscribe handler to the topics it declares
+func (b *Bus) Register(handler Handler) {
+	if subscriber, ok := handler.(Subscriber); ok {
+		b.Subscribe(handler, subscriber.Topics()...)
+	} else {
+		b.Subscribe(handler)
+	}
+}
+
+// Channel receiving messages of the given types, every type when
+// none is given, the bus waits for each to be received
+func (b *Bus) Listen(topics ...MessageType) <-chan Message {
+	listener := make(chan Message)
+	b.Subscribe(HandlerFunc(func(event Message) {
+		listener <- event
+	}), topics...)
+
+	return listener
+}
+
+// Queue event for its subscribers, never blocks, dropping it for
+// subscribers whose lane is full
+func (b *Bus) Publish(event Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	key := orderingKey(event)
+
+	for _, subscription := range b.subscriptions {
+		if !subscription.Wants(event) {
+			continue
+		}
+
+		id := laneKey{subscription: subscription, key: key}
+
+		if l, ok := b.lanes[id]; ok {
+			if len(l.events) >= MAX_LANE_LENGTH {
+				b.dropped.Inc(Labels{"type": string(event.Type)})
+				continue
+			}
+
+			l.events = append(l.events, event)
+			continue
+		}
+
+		l := &lane{events: []Message{event}}
+		b.lanes[id] = l
+
+		go b.drain(id, l)
+	}
+}
+
+// Hand the lane's messages to its handler until it's empty
+func (b *Bus) drain(id laneKey, l *lane) {
+	for {
+		b.mutex.Lock()
+
+		if len(l.events) == 0 {
+			delete(b.lanes, id)
+			b.mutex.Unlock()
+			return
+		}
+
+		event := l.events[0]
+		l.events = l.events[1:]
+
+		b.mutex.Unlock()
+
+		b.process(id.subscription.handler, event)
+	}
+}
+
+// A handler failing on a message mustn't take the server down with it
+func (b *Bus) process(handler Handler, event Message) {
+	defer func() {
+		if err := recover(); err != nil {
+			b.mutex.Lock()
+			logger := b.logger
+			b.mutex.Unlock()
+
+			logger.Error("Handler failed", "type", event.Type, "player_id", playerId(event.Player), "error", err)
+		}
+	}()
+
+	handler.Process(event)
+}
+
+func (b *Bus) Collect(metrics *MetricsWriter) {
+	metrics.Counter("chess_bus_dropped_total", "Messages dropped because a handler fell behind.", b.dropped)
+}
+
+// Messages about a game are ordered by game, new matches and games
+// by where their players come from, the rest by player
+func orderingKey(event Message) string {
+	switch payload := event.Payload.(type) {
+	case MatchParams:
+		if payload.Id != uuid.Nil {
+			return payload.Id.String()
+		}
+	case string:
+		if _, err := uuid.Parse(payload); err == nil {
+			return payload
+		}
+	case map[string]interface{}:
+		if gameId, ok := payload["game_id"].(string); ok && gameId != "" {
+			return gameId
+		}
+	}
+
+	if event.Player != nil {
+		return fmt.Sprintf("%p", event.Player)
+	}
+
+	return ""
+}
+
+// Use a function as a Handler
+type HandlerFunc func(event Message)
+
+func (f HandlerFunc) Process(event Message) {
+	f(event)
+}
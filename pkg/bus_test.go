@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBusDeliversSubscribedTopics(t *testing.T) {
+	bus := NewBus()
+	moves := bus.Listen(Move)
+	everything := bus.Listen()
+
+	bus.Publish(Message{Type: QueueUp})
+	bus.Publish(Message{Type: Move})
+
+	select {
+	case event := <-moves:
+		if event.Type != Move {
+			t.Errorf("Expected only moves, got %v", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected move, got timeout")
+	}
+
+	for _, expected := range []MessageType{QueueUp, Move} {
+		select {
+		case event := <-everything:
+			if event.Type != expected {
+				t.Errorf("Expected %v, got %v", expected, event.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected event, got timeout")
+		}
+	}
+}
+
+func TestBusSurvivesFailingHandlers(t *testing.T) {
+	bus := NewBus()
+	bus.Subscribe(HandlerFunc(func(event Message) {
+		panic("bad message")
+	}))
+	events := bus.Listen()
+
+	player := NewTestPlayer()
+
+	for i := 0; i < 2; i++ {
+		bus.Publish(Message{Type: Resign, Player: player})
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("Expected other handlers to keep getting messages")
+		}
+	}
+}
+
+func TestBusKeepsOrderPerPlayer(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+
+	player := NewTestPlayer()
+	moves := []string{"e2", "d2", "c2", "b2", "a2"}
+
+	for _, from := range moves {
+		bus.Publish(Message{
+			Type:    Move,
+			Player:  player,
+			Payload: map[string]interface{}{"from": from},
+		})
+	}
+
+	for _, from := range moves {
+		select {
+		case event := <-events:
+			if got := event.Payload.(map[string]interface{})["from"]; got != from {
+				t.Errorf("Expected %v, got %v", from, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected event, got timeout")
+		}
+	}
+}
+
+func TestBusesAreIndependent(t *testing.T) {
+	first := NewBus()
+	second := NewBus()
+
+	events := second.Listen()
+	first.Publish(Message{Type: QueueUp})
+
+	select {
+	case event := <-events:
+		t.Errorf("Expected nothing on the other bus, got %v", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBusSeparatesMatches(t *testing.T) {
+	bus := NewBus()
+
+	blocked := make(chan bool)
+	delivered := make(chan uuid.UUID, 2)
+
+	first := uuid.New()
+	second := uuid.New()
+
+	bus.Subscribe(HandlerFunc(func(event Message) {
+		params := event.Payload.(MatchParams)
+		if params.Id == first {
+			<-blocked
+		}
+		delivered <- params.Id
+	}), CreateGame)
+
+	bus.Publish(Message{Type: CreateGame, Payload: MatchParams{Id: first}})
+	bus.Publish(Message{Type: CreateGame, Payload: MatchParams{Id: second}})
+
+	select {
+	case id := <-delivered:
+		if id != second {
+			t.Errorf("Expected the second game to go first, got %v", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected games to be created independently, got timeout")
+	}
+
+	close(blocked)
+	<-delivered
+}
+
+func TestBusBoundsLanes(t *testing.T) {
+	bus := NewBus()
+
+	started := make(chan bool)
+	blocked := make(chan bool)
+	delivered := 0
+
+	bus.Subscribe(HandlerFunc(func(event Message) {
+		if delivered == 0 {
+			close(started)
+			<-blocked
+		}
+		delivered++
+	}))
+
+	player := NewTestPlayer()
+
+	bus.Publish(Message{Type: Move, Player: player})
+	<-started
+
+	for i := 0; i < MAX_LANE_LENGTH+10; i++ {
+		bus.Publish(Message{Type: Move, Player: player})
+	}
+
+	close(blocked)
+
+	// the lane is deleted once its handler caught up
+	for {
+		bus.mutex.Lock()
+		lanes := len(bus.lanes)
+		bus.mutex.Unlock()
+
+		if lanes == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if delivered != MAX_LANE_LENGTH+1 {
+		t.Errorf("Expected %v messages, got %v", MAX_LANE_LENGTH+1, delivered)
+	}
+}
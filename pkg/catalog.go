@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"time"
+)
+
+// Time control players may queue up for, by name
+type CatalogEntry struct {
+	Name string `json:"name"`
+	TimeControl
+}
+
+var DefaultCatalog = []CatalogEntry{
+	{"1+0 Bullet", TimeControl{Duration: "1m", Increment: "0s"}},
+	{"2+1 Bullet", TimeControl{Duration: "2m", Increment: "1s"}},
+	{"3+0 Blitz", TimeControl{Duration: "3m", Increment: "0s"}},
+	{"3+2 Blitz", TimeControl{Duration: "3m", Increment: "2s"}},
+	{"5+0 Blitz", TimeControl{Duration: "5m", Increment: "0s"}},
+	{"5+3 Blitz", TimeControl{Duration: "5m", Increment: "3s"}},
+	{"10+0 Rapid", TimeControl{Duration: "10m", Increment: "0s"}},
+	{"10+5 Rapid", TimeControl{Duration: "10m", Increment: "5s"}},
+	{"15+10 Rapid", TimeControl{Duration: "15m", Increment: "10s"}},
+	{"30+0 Classical", TimeControl{Duration: "30m", Increment: "0s"}},
+	{"30+20 Classical", TimeControl{Duration: "30m", Increment: "20s"}},
+	{"3 days Correspondence", TimeControl{Days: 3}},
+}
+
+// Whether a and b run the same clock however they're written,
+// e.g. 180s and 3m, variants aside
+func SameTimeControl(a, b TimeControl) bool {
+	if a.Days != b.Days || a.DelayMode != b.DelayMode || a.Stages != b.Stages {
+		return false
+	}
+
+	for _, pair := range [][2]string{
+		{a.Duration, b.Duration},
+		{a.Increment, b.Increment},
+		{a.Delay, b.Delay},
+	} {
+		if parseOptionalDuration(pair[0]) != parseOptionalDuration(pair[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Entry of catalog running timeControl's clock
+func FindCatalogEntry(catalog []CatalogEntry, timeControl TimeControl) (CatalogEntry, bool) {
+	for _, entry := range catalog {
+		if SameTimeControl(entry.TimeControl, timeControl) {
+			return entry, true
+		}
+	}
+
+	return CatalogEntry{}, false
+}
+
+// Unparsable durations never match valid ones
+func parseOptionalDuration(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return -1
+	}
+
+	return duration
+}
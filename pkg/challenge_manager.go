@@ -0,0 +1,381 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+type Challenge struct {
+	*Match
+
+	Challenger *Player
+	Opponent   *Player
+	Color      Color
+	Code       string
+}
+
+func NewChallenge(challenger, opponent *Player, color Color, timeControl TimeControl) *Challenge {
+	players := []*Player{challenger}
+	code := ""
+
+	if opponent != nil {
+		players = append(players, opponent)
+	} else {
+		code = strings.ToUpper(uuid.New().String()[:8])
+	}
+
+	return &Challenge{
+		Match: NewMatch(players, timeControl),
+
+		Challenger: challenger,
+		Opponent:   opponent,
+		Color:      color,
+		Code:       code,
+	}
+}
+
+// Join an open invite, returns false if someone got there first
+func (c *Challenge) Join(player *Player) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Opponent != nil || c.Challenger == player {
+		return false
+	}
+
+	c.Opponent = player
+	c.Players = append(c.Players, player)
+
+	return true
+}
+
+func (c *Challenge) IsOpponent(player *Player) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.Opponent == player
+}
+
+// Let challenger know the challenge is up and the opponent
+// that there is a challenge waiting for them
+func (c *Challenge) Announce() {
+	c.Challenger.Send(Response{
+		Type:    ChallengeCreated,
+		Payload: c.Response(),
+	})
+
+	c.mutex.Lock()
+	opponent := c.Opponent
+	c.mutex.Unlock()
+
+	if opponent != nil {
+		opponent.Send(Response{
+			Type:    ChallengeReceived,
+			Payload: c.Response(),
+		})
+	}
+}
+
+func (c *Challenge) Params() MatchParams {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return MatchParams{
+		Players:     []*Player{c.Challenger, c.Opponent},
+		TimeControl: c.TimeControl,
+		Color:       c.Color,
+	}
+}
+
+func (c *Challenge) Response() ChallengeResponse {
+	return ChallengeResponse{
+		ChallengeId: c.Id,
+		Challenger:  c.Challenger.Id,
+		Color:       c.Color,
+		TimeControl: c.TimeControl,
+		Code:        c.Code,
+	}
+}
+
+type ChallengeManager struct {
+	bus        *Bus
+	mutex      *sync.Mutex
+	timeout    time.Duration
+	colors     ColorPolicy
+	players    map[uuid.UUID]*Player
+	challenges map[uuid.UUID]*Challenge
+	draining   bool
+}
+
+func NewChallengeManager(bus *Bus, timeout time.Duration) *ChallengeManager {
+	return &ChallengeManager{
+		bus:        bus,
+		timeout:    timeout,
+		mutex:      new(sync.Mutex),
+		colors:     PreferredColors{BalancedColors{}},
+		players:    make(map[uuid.UUID]*Player),
+		challenges: make(map[uuid.UUID]*Challenge),
+	}
+}
+
+func (c *ChallengeManager) AddPlayer(player *Player) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.players[player.Id] = player
+}
+
+func (c *ChallengeManager) RemovePlayer(player *Player) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// only the connection that was added, not one on the same account
+	if c.players[player.Id] == player {
+		delete(c.players, player.Id)
+	}
+}
+
+func (c *ChallengeManager) FindPlayer(playerId uuid.UUID) *Player {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.players[playerId]
+}
+
+func (c *ChallengeManager) FindChallenge(challengeId uuid.UUID) *Challenge {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.challenges[challengeId]
+}
+
+func (c *ChallengeManager) FindInvite(code string) *Challenge {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, challenge := range c.challenges {
+		if challenge.Code != "" && challenge.Code == strings.ToUpper(code) {
+			return challenge
+		}
+	}
+
+	return nil
+}
+
+func (c *ChallengeManager) RemoveChallenge(challengeId uuid.UUID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.challenges, challengeId)
+}
+
+func (c *ChallengeManager) CreateChallenge(challenger, opponent *Player, color Color, timeControl TimeControl) *Challenge {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	challenge := NewChallenge(challenger, opponent, color, timeControl)
+	c.challenges[challenge.Id] = challenge
+
+	go func() {
+		challenge.Announce()
+		challenge.Confirm(challenger)
+
+		// bots take on every challenge
+		if opponent != nil && opponent.Bot {
+			challenge.Confirm(opponent)
+		}
+	}()
+
+	go challenge.WaitConfirmation(c.timeout)
+
+	go func() {
+		select {
+		case <-challenge.Ready:
+			c.RemoveChallenge(challenge.Id)
+
+			c.bus.Publish(Message{
+				Type: CreateGame,
+				Payload: MatchParams{
+					Id:          challenge.Id,
+					Players:     c.colors.Assign(challenge.Params()),
+					TimeControl: challenge.TimeControl,
+				},
+			})
+		case <-challenge.Canceled:
+			c.RemoveChallenge(challenge.Id)
+
+			for _, player := range challenge.Players {
+				player.Send(Response{
+					Type:    ChallengeCanceled,
+					Payload: challenge.Id,
+				})
+			}
+		}
+	}()
+
+	return challenge
+}
+
+func (c *ChallengeManager) CancelPlayerChallenges(player *Player) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, challenge := range c.challenges {
+		if challenge.Challenger == player || challenge.IsOpponent(player) {
+			challenge.Cancel()
+		}
+	}
+}
+
+// Cancel open challenges and refuse new ones, games started now
+// would only be suspended
+func (c *ChallengeManager) Drain(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.draining = true
+
+	for _, challenge := range c.challenges {
+		challenge.Cancel()
+	}
+
+	return nil
+}
+
+func (c *ChallengeManager) IsDraining() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.draining
+}
+
+func (c *ChallengeManager) Topics() []MessageType {
+	return []MessageType{
+		Connected,
+		ChallengePlayer,
+		AcceptChallenge,
+		DeclineChallenge,
+		CancelChallenge,
+		JoinInvite,
+		Disconnected,
+	}
+}
+
+func (c *ChallengeManager) Process(event Message) {
+	// nothing may start a game once the server is shutting down
+	starts := event.Type == ChallengePlayer || event.Type == AcceptChallenge || event.Type == JoinInvite
+	if starts && c.IsDraining() {
+		event.Player.Send(Response{
+			Type: Error,
+			Text: "Server is shutting down",
+		})
+		return
+	}
+
+	switch event.Type {
+	case Connected:
+		c.AddPlayer(event.Player)
+
+		event.Player.Send(Response{
+			Type:    Welcome,
+			Payload: event.Player.Id,
+		})
+
+	case ChallengePlayer:
+		var params ChallengeParams
+		mapstructure.Decode(event.Payload, &params)
+
+		var opponent *Player
+
+		if params.Opponent != "" {
+			opponentId, err := uuid.Parse(params.Opponent)
+			if err != nil {
+				return
+			}
+
+			opponent = c.FindPlayer(opponentId)
+			if opponent == nil || opponent == event.Player {
+				event.Player.Send(Response{
+					Type: Error,
+					Text: "Player not available",
+				})
+				return
+			}
+		}
+
+		// accepting mustn't start a game that can't be played
+		if !IsVariant(params.TimeControl.Variant) {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Unknown variant",
+			})
+			return
+		}
+
+		if err := ValidateTimeControl(params.TimeControl); err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid time control",
+			})
+			return
+		}
+
+		c.CreateChallenge(event.Player, opponent, params.Color, params.TimeControl)
+
+	case AcceptChallenge, DeclineChallenge, CancelChallenge:
+		challengeId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid challenge id",
+			})
+			return
+		}
+
+		challenge := c.FindChallenge(challengeId)
+		if challenge == nil {
+			return
+		}
+
+		if event.Type == AcceptChallenge && challenge.IsOpponent(event.Player) {
+			challenge.Confirm(event.Player)
+		}
+		if event.Type == DeclineChallenge && challenge.IsOpponent(event.Player) {
+			challenge.Cancel()
+		}
+		if event.Type == CancelChallenge && challenge.Challenger == event.Player {
+			challenge.Cancel()
+		}
+
+	case JoinInvite:
+		code, ok := event.Payload.(string)
+		if !ok {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid invite code",
+			})
+			return
+		}
+
+		challenge := c.FindInvite(code)
+
+		if challenge == nil || !challenge.Join(event.Player) {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invite not available",
+			})
+			return
+		}
+
+		challenge.Confirm(event.Player)
+
+	case Disconnected:
+		c.RemovePlayer(event.Player)
+		c.CancelPlayerChallenges(event.Player)
+	}
+}
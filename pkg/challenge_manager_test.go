@@ -0,0 +1,323 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWelcomesPlayer(t *testing.T) {
+	bus := NewBus()
+	manager := NewChallengeManager(bus, time.Second)
+	player := NewTestPlayer()
+	player.Id = uuid.New()
+
+	go manager.Process(Message{
+		Type:   Connected,
+		Player: player,
+	})
+
+	res := <-player.Outgoing
+	if res.Type != Welcome {
+		t.Errorf("Expected welcome, got %v", res.Type)
+	}
+	if res.Payload.(uuid.UUID) != player.Id {
+		t.Errorf("Expected player id %v, got %v", player.Id, res.Payload)
+	}
+	if manager.FindPlayer(player.Id) != player {
+		t.Error("Expected player to be registered")
+	}
+}
+
+func TestChallengeAccepted(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	manager := NewChallengeManager(bus, time.Second)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	p2.Id = uuid.New()
+
+	manager.AddPlayer(p2)
+
+	go manager.Process(Message{
+		Type:   ChallengePlayer,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"opponent": p2.Id.String(),
+			"color":    "black",
+			"time_control": map[string]interface{}{
+				"duration":  "3m",
+				"increment": "2s",
+			},
+		},
+	})
+
+	created := <-p1.Outgoing
+	if created.Type != ChallengeCreated {
+		t.Errorf("Expected challenge created, got %v", created.Type)
+	}
+
+	received := <-p2.Outgoing
+	if received.Type != ChallengeReceived {
+		t.Errorf("Expected challenge received, got %v", received.Type)
+	}
+
+	<-p1.Outgoing // wait other players
+
+	challenge := received.Payload.(ChallengeResponse)
+	if challenge.TimeControl.Duration != "3m" {
+		t.Errorf("Expected 3m duration, got %v", challenge.TimeControl.Duration)
+	}
+
+	go manager.Process(Message{
+		Type:    AcceptChallenge,
+		Player:  p2,
+		Payload: challenge.ChallengeId.String(),
+	})
+
+	<-p2.Outgoing // wait other players
+
+	select {
+	case res := <-events:
+		if res.Type != CreateGame {
+			t.Errorf("Expected create game, got %v", res.Type)
+		}
+
+		params := res.Payload.(MatchParams)
+		if params.Players[0] != p2 || params.Players[1] != p1 {
+			t.Error("Expected challenger to play black")
+		}
+		if params.TimeControl.Increment != "2s" {
+			t.Errorf("Expected 2s increment, got %v", params.TimeControl.Increment)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected game to be created, got timeout")
+	}
+
+	if manager.FindChallenge(challenge.ChallengeId) != nil {
+		t.Error("Expected challenge to be removed")
+	}
+}
+
+func TestChallengeDeclined(t *testing.T) {
+	bus := NewBus()
+	manager := NewChallengeManager(bus, time.Second)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	p2.Id = uuid.New()
+
+	manager.AddPlayer(p2)
+
+	go manager.Process(Message{
+		Type:   ChallengePlayer,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"opponent":     p2.Id.String(),
+			"time_control": map[string]interface{}{"duration": "5m"},
+		},
+	})
+
+	<-p1.Outgoing
+	received := <-p2.Outgoing
+	<-p1.Outgoing
+
+	challenge := received.Payload.(ChallengeResponse)
+
+	go manager.Process(Message{
+		Type:    DeclineChallenge,
+		Player:  p2,
+		Payload: challenge.ChallengeId.String(),
+	})
+
+	for _, player := range []*Player{p1, p2} {
+		select {
+		case res := <-player.Outgoing:
+			if res.Type != ChallengeCanceled {
+				t.Errorf("Expected challenge canceled, got %v", res.Type)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected challenge canceled, got timeout")
+		}
+	}
+}
+
+func TestInviteCode(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	manager := NewChallengeManager(bus, time.Second)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	p3 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   ChallengePlayer,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"color":        "white",
+			"time_control": map[string]interface{}{"duration": "5m"},
+		},
+	})
+
+	created := <-p1.Outgoing
+	<-p1.Outgoing
+
+	code := created.Payload.(ChallengeResponse).Code
+	if code == "" {
+		t.Fatal("Expected invite code")
+	}
+
+	go manager.Process(Message{
+		Type:    JoinInvite,
+		Player:  p2,
+		Payload: code,
+	})
+
+	<-p2.Outgoing
+
+	select {
+	case res := <-events:
+		params := res.Payload.(MatchParams)
+		if params.Players[0] != p1 || params.Players[1] != p2 {
+			t.Error("Expected inviter to play white")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected game to be created, got timeout")
+	}
+
+	go manager.Process(Message{
+		Type:    JoinInvite,
+		Player:  p3,
+		Payload: code,
+	})
+
+	if res := <-p3.Outgoing; res.Type != Error {
+		t.Errorf("Expected invite to be used, got %v", res.Type)
+	}
+}
+
+func TestMalformedChallengePayload(t *testing.T) {
+	manager := NewChallengeManager(NewBus(), time.Second)
+
+	for _, kind := range []MessageType{AcceptChallenge, DeclineChallenge, CancelChallenge} {
+		expectError(t, manager, Message{
+			Type:    kind,
+			Player:  NewTestPlayer(),
+			Payload: 42,
+		}, "Invalid challenge id")
+	}
+
+	expectError(t, manager, Message{
+		Type:    JoinInvite,
+		Player:  NewTestPlayer(),
+		Payload: map[string]interface{}{"code": "ABC123"},
+	}, "Invalid invite code")
+}
+
+func TestChallengeNeedsValidTimeControl(t *testing.T) {
+	manager := NewChallengeManager(NewBus(), time.Second)
+
+	expectError(t, manager, Message{
+		Type:   ChallengePlayer,
+		Player: NewTestPlayer(),
+		Payload: map[string]interface{}{
+			"time_control": map[string]interface{}{"duration": "forever"},
+		},
+	}, "Invalid time control")
+
+	expectError(t, manager, Message{
+		Type:   ChallengePlayer,
+		Player: NewTestPlayer(),
+		Payload: map[string]interface{}{
+			"time_control": map[string]interface{}{"duration": "5m", "variant": "checkers"},
+		},
+	}, "Unknown variant")
+
+	if len(manager.challenges) != 0 {
+		t.Error("Expected no challenge to be created")
+	}
+}
+
+func TestDrainCancelsChallenges(t *testing.T) {
+	manager := NewChallengeManager(NewBus(), time.Second)
+
+	p1 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   ChallengePlayer,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"time_control": map[string]interface{}{"duration": "5m"},
+		},
+	})
+
+	created := <-p1.Outgoing
+	<-p1.Outgoing
+
+	code := created.Payload.(ChallengeResponse).Code
+
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-p1.Outgoing:
+		if res.Type != ChallengeCanceled {
+			t.Errorf("Expected challenge canceled, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected challenge canceled, got timeout")
+	}
+
+	expectError(t, manager, Message{
+		Type:    JoinInvite,
+		Player:  NewTestPlayer(),
+		Payload: code,
+	}, "Server is shutting down")
+
+	expectError(t, manager, Message{
+		Type:    ChallengePlayer,
+		Player:  p1,
+		Payload: map[string]interface{}{},
+	}, "Server is shutting down")
+}
+
+func TestBotsAcceptChallenges(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	manager := NewChallengeManager(bus, time.Second)
+
+	p1 := NewTestPlayer()
+	bot := NewTestPlayer()
+	bot.Id = uuid.New()
+	bot.Bot = true
+
+	manager.AddPlayer(bot)
+
+	go manager.Process(Message{
+		Type:   ChallengePlayer,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"opponent":     bot.Id.String(),
+			"time_control": map[string]interface{}{"duration": "5m"},
+		},
+	})
+
+	<-p1.Outgoing // challenge created
+	<-bot.Outgoing
+	<-p1.Outgoing
+	<-bot.Outgoing // wait other players
+
+	select {
+	case res := <-events:
+		if res.Type != CreateGame {
+			t.Errorf("Expected create game, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected game to be created, got timeout")
+	}
+}
@@ -16,7 +16,7 @@ type Client struct {
 
 // Create a new test client
 func NewClient() (*Client, error) {
-	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
 
 	if err != nil {
 		return nil, err
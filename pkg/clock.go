@@ -0,0 +1,419 @@
+package pkg
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Time only starts running after the delay
+	SimpleDelay = "simple"
+
+	// Time used up to the delay is given back after the move
+	BronsteinDelay = "bronstein"
+)
+
+// Time added once a player completes Moves more moves,
+// e.g. 40/30m adds 30 minutes after the 40th move
+type ClockStage struct {
+	Moves int
+	Time  time.Duration
+}
+
+// Parse stages such as "40/30m,20/15m", each counting
+// moves from the end of the previous stage
+func ParseStages(stages string) ([]ClockStage, error) {
+	parsed := []ClockStage{}
+
+	if stages == "" {
+		return parsed, nil
+	}
+
+	for _, stage := range strings.Split(stages, ",") {
+		parts := strings.SplitN(stage, "/", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid stage")
+		}
+
+		moves, err := strconv.Atoi(parts[0])
+		if err != nil || moves < 1 {
+			return nil, errors.New("Invalid stage")
+		}
+
+		duration, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.New("Invalid stage")
+		}
+
+		parsed = append(parsed, ClockStage{Moves: moves, Time: duration})
+	}
+
+	return parsed, nil
+}
+
+type clockSide struct {
+	left  time.Duration
+	lag   time.Duration
+	moves int
+	stage int
+}
+
+// Clock keeps both players' time, only one side runs at once and
+// running out of time is reported once through Flag
+type Clock struct {
+	mutex *sync.Mutex
+
+	increment time.Duration
+	perMove   time.Duration
+	delay     time.Duration
+	delayMode string
+	stages    []ClockStage
+
+	sides   map[Color]*clockSide
+	running Color
+	start   time.Time
+	spent   time.Duration
+	grace   time.Duration
+	paused  bool
+
+	timer   *time.Timer
+	flag    chan Color
+	done    chan bool
+	stopped bool
+}
+
+func NewClock(timeControl TimeControl) (*Clock, error) {
+	clock, err := parseClock(timeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	go clock.watch()
+
+	return clock, nil
+}
+
+// Check the time control can be put on a clock
+func ValidateTimeControl(timeControl TimeControl) error {
+	_, err := parseClock(timeControl)
+	return err
+}
+
+func parseClock(timeControl TimeControl) (*Clock, error) {
+	if timeControl.Days < 0 {
+		return nil, errors.New("Invalid days per move")
+	}
+
+	// correspondence games get a fresh allowance each move
+	perMove := time.Duration(timeControl.Days) * 24 * time.Hour
+	duration := perMove
+
+	if perMove == 0 {
+		var err error
+		if duration, err = time.ParseDuration(timeControl.Duration); err != nil {
+			return nil, err
+		}
+	}
+
+	clock := &Clock{
+		mutex:     new(sync.Mutex),
+		perMove:   perMove,
+		delayMode: timeControl.DelayMode,
+
+		sides: map[Color]*clockSide{
+			White: {left: duration},
+			Black: {left: duration},
+		},
+
+		timer: time.NewTimer(time.Hour),
+		flag:  make(chan Color, 1),
+		done:  make(chan bool),
+	}
+	clock.timer.Stop()
+
+	var err error
+
+	if timeControl.Increment != "" {
+		if clock.increment, err = time.ParseDuration(timeControl.Increment); err != nil {
+			return nil, err
+		}
+	}
+
+	if timeControl.Delay != "" {
+		if clock.delay, err = time.ParseDuration(timeControl.Delay); err != nil {
+			return nil, err
+		}
+		if clock.delayMode == "" {
+			clock.delayMode = SimpleDelay
+		}
+	}
+
+	if clock.delayMode != "" && clock.delayMode != SimpleDelay && clock.delayMode != BronsteinDelay {
+		return nil, errors.New("Invalid delay mode")
+	}
+
+	if clock.stages, err = ParseStages(timeControl.Stages); err != nil {
+		return nil, err
+	}
+
+	return clock, nil
+}
+
+// Receives the color of the side that ran out of time, at most once
+func (c *Clock) Flag() <-chan Color {
+	return c.flag
+}
+
+// Closed once the clock is stopped for good, after the flag
+func (c *Clock) Done() <-chan bool {
+	return c.done
+}
+
+func (c *Clock) watch() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.timer.C:
+			c.mutex.Lock()
+
+			if c.running == "" || c.paused {
+				c.mutex.Unlock()
+				continue
+			}
+
+			// timer may have fired right before being reset
+			if left := c.remaining(c.running) + c.grace; left > 0 {
+				c.timer.Reset(left)
+				c.mutex.Unlock()
+				continue
+			}
+
+			// flag goes out before done so whoever waits on
+			// done finds it there
+			c.flag <- c.running
+			c.sides[c.running].left = 0
+			c.running = ""
+			c.close()
+
+			c.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// Start color's time, grace is extra time allowed before flagging
+// for lag that is credited back when the move comes in
+func (c *Clock) Start(color Color, grace time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped || c.running != "" {
+		return
+	}
+
+	c.running = color
+	c.start = time.Now()
+	c.spent = 0
+	c.grace = grace
+
+	if !c.paused && !c.IsCorrespondence() {
+		c.timer.Reset(c.deadline())
+	}
+}
+
+// Days per move clocks don't keep a live timer, deadlines
+// are left to a DeadlineScheduler
+func (c *Clock) IsCorrespondence() bool {
+	return c.perMove > 0
+}
+
+// Set the time color has left, e.g. when restoring a game
+func (c *Clock) Set(color Color, left time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.running != color {
+		c.sides[color].left = left
+	}
+}
+
+// Stop color's time after a move, crediting up to lag back,
+// the side flags if its time ran out before the move, which is
+// returned so the move isn't counted
+func (c *Clock) Stop(color Color, lag time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.running != color {
+		return false
+	}
+
+	c.timer.Stop()
+
+	elapsed := c.elapsed()
+	if lag > elapsed {
+		lag = elapsed
+	}
+	elapsed -= lag
+
+	side := c.sides[color]
+	side.lag += lag
+	side.left -= c.charged(elapsed)
+
+	// the move came in too late, increments don't save it, while
+	// correspondence deadlines are left to the scheduler
+	if side.left < 0 && !c.IsCorrespondence() {
+		c.flag <- color
+		side.left = 0
+		c.running = ""
+		c.close()
+		return true
+	}
+
+	if c.delayMode == BronsteinDelay {
+		side.left += minDuration(elapsed, c.delay)
+	}
+
+	side.left += c.increment
+	side.moves++
+
+	if c.IsCorrespondence() {
+		side.left = c.perMove
+	}
+
+	if side.stage < len(c.stages) && side.moves == c.stages[side.stage].Moves {
+		side.left += c.stages[side.stage].Time
+		side.moves = 0
+		side.stage++
+	}
+
+	c.running = ""
+
+	return false
+}
+
+// Hold the running side's time, e.g. while a dispute is settled
+func (c *Clock) Pause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.paused || c.stopped {
+		return
+	}
+
+	if c.running != "" {
+		c.spent += time.Since(c.start)
+		c.timer.Stop()
+	}
+
+	c.paused = true
+}
+
+func (c *Clock) Resume() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.paused || c.stopped {
+		return
+	}
+
+	c.paused = false
+
+	if c.running != "" && !c.IsCorrespondence() {
+		c.start = time.Now()
+		c.timer.Reset(c.deadline())
+	}
+}
+
+func (c *Clock) IsPaused() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.paused
+}
+
+// Time color has left, never negative
+func (c *Clock) Remaining(color Color) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if left := c.remaining(color); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Lag credited back to color so far
+func (c *Clock) Compensated(color Color) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.sides[color].lag
+}
+
+// Stop the clock for good, the flag won't fire after this
+func (c *Clock) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.close()
+}
+
+func (c *Clock) close() {
+	if !c.stopped {
+		c.stopped = true
+		c.timer.Stop()
+		close(c.done)
+	}
+}
+
+func (c *Clock) remaining(color Color) time.Duration {
+	left := c.sides[color].left
+
+	if c.running == color {
+		left -= c.charged(c.elapsed())
+	}
+
+	return left
+}
+
+// Time spent on the running turn
+func (c *Clock) elapsed() time.Duration {
+	if c.paused {
+		return c.spent
+	}
+	return c.spent + time.Since(c.start)
+}
+
+// Time taken off the clock for elapsed
+func (c *Clock) charged(elapsed time.Duration) time.Duration {
+	if c.delayMode == SimpleDelay {
+		if elapsed < c.delay {
+			return 0
+		}
+		return elapsed - c.delay
+	}
+	return elapsed
+}
+
+// Wall time until the running side flags
+func (c *Clock) deadline() time.Duration {
+	deadline := c.sides[c.running].left + c.grace - c.spent
+
+	if c.delayMode == SimpleDelay {
+		deadline += c.delay
+	}
+
+	return deadline
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,242 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func within(got, want time.Duration) bool {
+	return got >= want-20*time.Millisecond && got <= want+20*time.Millisecond
+}
+
+func TestClockIncrement(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "1s", Increment: "500ms"})
+	defer clock.Close()
+
+	clock.Start(White, 0)
+	time.Sleep(100 * time.Millisecond)
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); !within(left, 1400*time.Millisecond) {
+		t.Errorf("Expected 1.4s, got %v", left)
+	}
+	if left := clock.Remaining(Black); left != time.Second {
+		t.Errorf("Expected black's time untouched, got %v", left)
+	}
+}
+
+func TestClockSimpleDelay(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "1s", Delay: "200ms"})
+	defer clock.Close()
+
+	clock.Start(White, 0)
+	time.Sleep(100 * time.Millisecond)
+
+	if left := clock.Remaining(White); left != time.Second {
+		t.Errorf("Expected clock to wait for the delay, got %v", left)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); !within(left, 900*time.Millisecond) {
+		t.Errorf("Expected 900ms, got %v", left)
+	}
+}
+
+func TestClockBronsteinDelay(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "1s", Delay: "200ms", DelayMode: BronsteinDelay})
+	defer clock.Close()
+
+	clock.Start(White, 0)
+	time.Sleep(100 * time.Millisecond)
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); !within(left, time.Second) {
+		t.Errorf("Expected time used to be given back, got %v", left)
+	}
+
+	clock.Start(White, 0)
+	time.Sleep(300 * time.Millisecond)
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); !within(left, 900*time.Millisecond) {
+		t.Errorf("Expected no more than the delay back, got %v", left)
+	}
+}
+
+func TestClockStages(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "1s", Stages: "2/1s,1/500ms"})
+	defer clock.Close()
+
+	for i := 0; i < 2; i++ {
+		clock.Start(White, 0)
+		clock.Stop(White, 0)
+	}
+
+	if left := clock.Remaining(White); !within(left, 2*time.Second) {
+		t.Errorf("Expected second stage time, got %v", left)
+	}
+
+	clock.Start(White, 0)
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); !within(left, 2500*time.Millisecond) {
+		t.Errorf("Expected third stage time, got %v", left)
+	}
+}
+
+func TestClockFlagsOnce(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "100ms"})
+
+	clock.Start(Black, 0)
+
+	select {
+	case color := <-clock.Flag():
+		if color != Black {
+			t.Errorf("Expected black to flag, got %v", color)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected flag, got timeout")
+	}
+
+	select {
+	case <-clock.Done():
+	case <-time.After(time.Second):
+		t.Error("Expected clock to stop")
+	}
+
+	if clock.Remaining(Black) != 0 {
+		t.Errorf("Expected no time left, got %v", clock.Remaining(Black))
+	}
+
+	// nothing runs after the flag
+	clock.Start(White, 0)
+
+	select {
+	case <-clock.Flag():
+		t.Error("Expected a single flag")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestClockPause(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "200ms"})
+	defer clock.Close()
+
+	clock.Start(White, 0)
+	time.Sleep(100 * time.Millisecond)
+	clock.Pause()
+
+	select {
+	case <-clock.Flag():
+		t.Fatal("Expected paused clock not to flag")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if left := clock.Remaining(White); !within(left, 100*time.Millisecond) {
+		t.Errorf("Expected time to stand still, got %v", left)
+	}
+
+	clock.Resume()
+
+	select {
+	case <-clock.Flag():
+	case <-time.After(time.Second):
+		t.Error("Expected flag after resuming")
+	}
+}
+
+func TestClockGrace(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "100ms"})
+	defer clock.Close()
+
+	clock.Start(White, 100*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	clock.Stop(White, 100*time.Millisecond)
+
+	select {
+	case <-clock.Flag():
+		t.Error("Expected lag not to flag")
+	default:
+	}
+
+	if left := clock.Remaining(White); !within(left, 50*time.Millisecond) {
+		t.Errorf("Expected lag to be credited, got %v", left)
+	}
+}
+
+func TestClockFlagsLateMove(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "100ms", Increment: "1s"})
+	defer clock.Close()
+
+	clock.Start(White, 100*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+
+	if !clock.Stop(White, 0) {
+		t.Error("Expected Stop to tell the side flagged")
+	}
+
+	select {
+	case color := <-clock.Flag():
+		if color != White {
+			t.Errorf("Expected white to flag, got %v", color)
+		}
+	default:
+		t.Error("Expected a move past the time to flag")
+	}
+
+	if left := clock.Remaining(White); left != 0 {
+		t.Errorf("Expected no increment after the flag, got %v", left)
+	}
+}
+
+func TestClockStopWhenNotRunning(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Duration: "1s"})
+	defer clock.Close()
+
+	clock.Stop(Black, 0)
+
+	if clock.Remaining(Black) != time.Second {
+		t.Errorf("Expected stopped clock to keep its time, got %v", clock.Remaining(Black))
+	}
+}
+
+func TestInvalidTimeControl(t *testing.T) {
+	invalid := []TimeControl{
+		{Duration: "forever"},
+		{Duration: "1m", Increment: "x"},
+		{Duration: "1m", Delay: "2s", DelayMode: "hourglass"},
+		{Duration: "1m", Stages: "40"},
+	}
+
+	for _, timeControl := range invalid {
+		if ValidateTimeControl(timeControl) == nil {
+			t.Errorf("Expected %+v to be invalid", timeControl)
+		}
+	}
+}
+
+func TestCorrespondenceClock(t *testing.T) {
+	clock, _ := NewClock(TimeControl{Days: 2})
+	defer clock.Close()
+
+	if !clock.IsCorrespondence() {
+		t.Fatal("Expected correspondence clock")
+	}
+
+	clock.Set(White, 10*time.Millisecond)
+	clock.Start(White, 0)
+
+	select {
+	case <-clock.Flag():
+		t.Error("Expected deadlines to be left to the scheduler")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Stop(White, 0)
+
+	if left := clock.Remaining(White); left != 48*time.Hour {
+		t.Errorf("Expected a fresh 2 days, got %v", left)
+	}
+}
@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"math/rand"
+)
+
+// Decides who plays white, returns the players white first
+type ColorPolicy interface {
+	Assign(params MatchParams) []*Player
+}
+
+// Flip a coin
+type RandomColors struct{}
+
+func (r RandomColors) Assign(params MatchParams) []*Player {
+	white, black := params.Players[0], params.Players[1]
+
+	if rand.Intn(2) == 1 {
+		white, black = black, white
+	}
+
+	return []*Player{white, black}
+}
+
+// Give white to whoever played black more often recently,
+// flipping a coin when both are even
+type BalancedColors struct{}
+
+func (b BalancedColors) Assign(params MatchParams) []*Player {
+	white, black := params.Players[0], params.Players[1]
+
+	balanceWhite := white.ColorBalance()
+	balanceBlack := black.ColorBalance()
+
+	if balanceWhite == balanceBlack {
+		return RandomColors{}.Assign(params)
+	}
+
+	if balanceWhite > balanceBlack {
+		white, black = black, white
+	}
+
+	return []*Player{white, black}
+}
+
+// Honor the color the first player asked for, falling back
+// to another policy when there's no preference
+type PreferredColors struct {
+	Fallback ColorPolicy
+}
+
+func (p PreferredColors) Assign(params MatchParams) []*Player {
+	switch params.Color {
+	case White:
+		return []*Player{params.Players[0], params.Players[1]}
+	case Black:
+		return []*Player{params.Players[1], params.Players[0]}
+	}
+
+	return p.Fallback.Assign(params)
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"testing"
+)
+
+func TestRandomColors(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	white := map[*Player]bool{}
+
+	for i := 0; i < 100; i++ {
+		players := RandomColors{}.Assign(MatchParams{
+			Players: []*Player{p1, p2},
+		})
+		white[players[0]] = true
+	}
+
+	if !white[p1] || !white[p2] {
+		t.Error("Expected both players to get white at some point")
+	}
+}
+
+func TestBalancedColors(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	p1.RecordColor(White)
+	p1.RecordColor(White)
+	p2.RecordColor(White)
+	p2.RecordColor(Black)
+
+	for i := 0; i < 10; i++ {
+		players := BalancedColors{}.Assign(MatchParams{
+			Players: []*Player{p1, p2},
+		})
+
+		if players[0] != p2 {
+			t.Fatal("Expected player with fewer whites to get white")
+		}
+	}
+}
+
+func TestColorHistoryIsBounded(t *testing.T) {
+	player := NewTestPlayer()
+
+	for i := 0; i < COLOR_HISTORY; i++ {
+		player.RecordColor(White)
+	}
+	for i := 0; i < COLOR_HISTORY; i++ {
+		player.RecordColor(Black)
+	}
+
+	if player.ColorBalance() != -COLOR_HISTORY {
+		t.Errorf("Expected only recent games to count, got %v", player.ColorBalance())
+	}
+}
+
+func TestPreferredColors(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	p1.RecordColor(Black)
+
+	policy := PreferredColors{BalancedColors{}}
+
+	players := policy.Assign(MatchParams{
+		Players: []*Player{p1, p2},
+		Color:   Black,
+	})
+	if players[0] != p2 {
+		t.Error("Expected p1 to get black as requested")
+	}
+
+	players = policy.Assign(MatchParams{
+		Players: []*Player{p1, p2},
+	})
+	if players[0] != p1 {
+		t.Error("Expected to fall back to color balancing")
+	}
+}
@@ -0,0 +1,438 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+// Duration read from strings such as "10s" or "5m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type TLSConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+type Timeouts struct {
+	// players confirming a match found in the queue
+	Match Duration `json:"match"`
+
+	// opponents answering a challenge
+	Challenge Duration `json:"challenge"`
+
+	// players agreeing on a rematch
+	Rematch Duration `json:"rematch"`
+
+	// first moves before the game is aborted, short time controls
+	// get their starting time instead, see MIN_ABORT_TIMEOUT
+	Abort Duration `json:"abort"`
+
+	// players coming back to games suspended on shutdown
+	Resume Duration `json:"resume"`
+
+	// games finishing before the server goes down
+	Shutdown Duration `json:"shutdown"`
+}
+
+// Tokens per second up to a burst, see RateLimiter
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type RateLimits struct {
+	Chat RateLimit `json:"chat"`
+
+	// messages from each connection and from each address
+	Messages  RateLimit `json:"messages"`
+	Addresses RateLimit `json:"addresses"`
+}
+
+type ConnectionLimits struct {
+	// connections open at once from one address, no cap when 0
+	PerAddr int `json:"per_addr"`
+
+	// bytes of a single message
+	MessageSize int64 `json:"message_size"`
+
+	// times a minute connections from an address may go over
+	// their rate limits before they're closed
+	Violations int `json:"violations"`
+
+	// addresses or CIDR networks of reverse proxies, clients behind
+	// them are told apart by X-Forwarded-For
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// Config of the server binary, read from a JSON file and
+// overridden by CHESS_ environment variables and then by command-line
+// flags
+type Config struct {
+	Listen       string           `json:"listen"`
+	TLS          TLSConfig        `json:"tls"`
+	Origins      []string         `json:"origins"`
+	Timeouts     Timeouts         `json:"timeouts"`
+	TimeControls []CatalogEntry   `json:"time_controls"`
+	RateLimits   RateLimits       `json:"rate_limits"`
+	Connections  ConnectionLimits `json:"connections"`
+	StoragePath  string           `json:"storage_path"`
+	LogLevel     string           `json:"log_level"`
+
+	// moves and results are appended here when set
+	AuditLog string `json:"audit_log"`
+
+	// bearer token of the admin API, which is off without one
+	AdminToken string `json:"admin_token"`
+
+	// tokens of bot accounts by name
+	BotTokens map[string]string `json:"bot_tokens"`
+
+	// UCI engine played as a bot under the program's name
+	UCIEngine string `json:"uci_engine"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Listen:  "0.0.0.0:8080",
+		Origins: []string{},
+
+		Timeouts: Timeouts{
+			Match:     Duration(10 * time.Second),
+			Challenge: Duration(5 * time.Minute),
+			Rematch:   Duration(REMATCH_TIMEOUT),
+			Abort:     Duration(ABORT_TIMEOUT),
+			Resume:    Duration(RESUME_TIMEOUT),
+			Shutdown:  Duration(30 * time.Second),
+		},
+
+		TimeControls: append([]CatalogEntry{}, DefaultCatalog...),
+
+		RateLimits: RateLimits{
+			Chat:      RateLimit{Rate: CHAT_RATE, Burst: CHAT_BURST},
+			Messages:  RateLimit{Rate: MESSAGE_RATE, Burst: MESSAGE_BURST},
+			Addresses: RateLimit{Rate: ADDR_MESSAGE_RATE, Burst: ADDR_MESSAGE_BURST},
+		},
+
+		Connections: ConnectionLimits{
+			PerAddr:     MAX_CONNECTIONS_PER_ADDR,
+			MessageSize: MAX_MESSAGE_SIZE,
+			Violations:  MAX_VIOLATIONS,
+		},
+
+		StoragePath: "data",
+		LogLevel:    LogInfo,
+		BotTokens:   map[string]string{},
+	}
+}
+
+// Defaults, then the file named by -config or CHESS_CONFIG, then
+// environment variables and flags, validated
+func ParseConfig(args []string, getenv func(string) string) (*Config, error) {
+	flags := flag.NewFlagSet("chess-server", flag.ContinueOnError)
+
+	path := flags.String("config", getenv("CHESS_CONFIG"), "path to a JSON config file")
+	listen := flags.String("listen", "", "address to listen on")
+	cert := flags.String("tls-cert", "", "TLS certificate file")
+	key := flags.String("tls-key", "", "TLS key file")
+	storage := flags.String("storage", "", "directory games are kept in")
+	logLevel := flags.String("log-level", "", "debug, info, warn or error")
+	auditLog := flags.String("audit-log", "", "file moves and results are appended to")
+	engine := flags.String("uci-engine", "", "UCI engine played as a bot")
+	origins := flags.String("origins", "", "comma separated origins allowed to connect")
+	messageSize := flags.Int64("message-size", 0, "bytes of a single message")
+	violations := flags.Int("violations", 0, "rate limit violations a minute before connections are closed")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+
+	if *path != "" {
+		if err := config.Load(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Override(getenv); err != nil {
+		return nil, err
+	}
+
+	for value, setting := range map[*string]*string{
+		listen:   &config.Listen,
+		cert:     &config.TLS.Cert,
+		key:      &config.TLS.Key,
+		storage:  &config.StoragePath,
+		logLevel: &config.LogLevel,
+		auditLog: &config.AuditLog,
+		engine:   &config.UCIEngine,
+	} {
+		if *value != "" {
+			*setting = *value
+		}
+	}
+
+	if *origins != "" {
+		config.Origins = strings.Split(*origins, ",")
+	}
+
+	if *messageSize != 0 {
+		config.Connections.MessageSize = *messageSize
+	}
+
+	if *violations != 0 {
+		config.Connections.Violations = *violations
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Read the JSON file at path over the current values
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// decoding into the slice would keep fields of the entries
+	// it replaces, a catalog in the file replaces it as a whole
+	catalog := c.TimeControls
+	c.TimeControls = nil
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if c.TimeControls == nil {
+		c.TimeControls = catalog
+	}
+
+	return nil
+}
+
+// Take settings from environment variables that are set
+func (c *Config) Override(getenv func(string) string) error {
+	for name, setting := range map[string]*string{
+		"CHESS_LISTEN":      &c.Listen,
+		"CHESS_TLS_CERT":    &c.TLS.Cert,
+		"CHESS_TLS_KEY":     &c.TLS.Key,
+		"CHESS_STORAGE":     &c.StoragePath,
+		"CHESS_LOG_LEVEL":   &c.LogLevel,
+		"CHESS_AUDIT_LOG":   &c.AuditLog,
+		"CHESS_ADMIN_TOKEN": &c.AdminToken,
+	} {
+		if value := getenv(name); value != "" {
+			*setting = value
+		}
+	}
+
+	for name, timeout := range map[string]*Duration{
+		"CHESS_MATCH_TIMEOUT":     &c.Timeouts.Match,
+		"CHESS_CHALLENGE_TIMEOUT": &c.Timeouts.Challenge,
+		"CHESS_REMATCH_TIMEOUT":   &c.Timeouts.Rematch,
+		"CHESS_ABORT_TIMEOUT":     &c.Timeouts.Abort,
+		"CHESS_RESUME_TIMEOUT":    &c.Timeouts.Resume,
+		"CHESS_SHUTDOWN_TIMEOUT":  &c.Timeouts.Shutdown,
+	} {
+		if value := getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*timeout = Duration(duration)
+		}
+	}
+
+	for name, rate := range map[string]*float64{
+		"CHESS_CHAT_RATE":         &c.RateLimits.Chat.Rate,
+		"CHESS_MESSAGE_RATE":      &c.RateLimits.Messages.Rate,
+		"CHESS_ADDR_MESSAGE_RATE": &c.RateLimits.Addresses.Rate,
+	} {
+		if value := getenv(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*rate = parsed
+		}
+	}
+
+	for name, list := range map[string]*[]string{
+		"CHESS_ORIGINS":         &c.Origins,
+		"CHESS_TRUSTED_PROXIES": &c.Connections.TrustedProxies,
+	} {
+		if value := getenv(name); value != "" {
+			*list = strings.Split(value, ",")
+		}
+	}
+
+	for name, count := range map[string]*int{
+		"CHESS_CHAT_BURST":           &c.RateLimits.Chat.Burst,
+		"CHESS_MESSAGE_BURST":        &c.RateLimits.Messages.Burst,
+		"CHESS_ADDR_MESSAGE_BURST":   &c.RateLimits.Addresses.Burst,
+		"CHESS_CONNECTIONS_PER_ADDR": &c.Connections.PerAddr,
+		"CHESS_VIOLATIONS":           &c.Connections.Violations,
+	} {
+		if value := getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*count = parsed
+		}
+	}
+
+	if value := getenv("CHESS_MESSAGE_SIZE"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("CHESS_MESSAGE_SIZE: %w", err)
+		}
+		c.Connections.MessageSize = parsed
+	}
+
+	if value := getenv("CHESS_UCI_ENGINE"); value != "" {
+		c.UCIEngine = value
+	}
+
+	// e.g. CHESS_BOT_TOKENS=engine:secret,other:secret2
+	if value := getenv("CHESS_BOT_TOKENS"); value != "" {
+		tokens, err := ParseBotTokens(value)
+		if err != nil {
+			return fmt.Errorf("CHESS_BOT_TOKENS: %w", err)
+		}
+		c.BotTokens = tokens
+	}
+
+	return nil
+}
+
+// Bot tokens written as name:token pairs separated by commas
+func ParseBotTokens(value string) (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Expected name:token, got %q", entry)
+		}
+
+		tokens[parts[0]] = parts[1]
+	}
+
+	return tokens, nil
+}
+
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return errors.New("Missing listen address")
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return errors.New("TLS needs both a certificate and a key")
+	}
+
+	for name, timeout := range map[string]Duration{
+		"match":     c.Timeouts.Match,
+		"challenge": c.Timeouts.Challenge,
+		"rematch":   c.Timeouts.Rematch,
+		"abort":     c.Timeouts.Abort,
+		"resume":    c.Timeouts.Resume,
+		"shutdown":  c.Timeouts.Shutdown,
+	} {
+		if timeout <= 0 {
+			return fmt.Errorf("Invalid %s timeout", name)
+		}
+	}
+
+	if len(c.TimeControls) == 0 {
+		return errors.New("Missing time controls")
+	}
+
+	names := make(map[string]bool)
+
+	for _, entry := range c.TimeControls {
+		if entry.Name == "" || names[entry.Name] {
+			return fmt.Errorf("Time controls need distinct names, got %q", entry.Name)
+		}
+		names[entry.Name] = true
+
+		if err := ValidateTimeControl(entry.TimeControl); err != nil {
+			return fmt.Errorf("Invalid time control %q", entry.Name)
+		}
+	}
+
+	for name, limit := range map[string]RateLimit{
+		"chat":    c.RateLimits.Chat,
+		"message": c.RateLimits.Messages,
+		"address": c.RateLimits.Addresses,
+	} {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return fmt.Errorf("Invalid %s rate limit", name)
+		}
+	}
+
+	if c.Connections.PerAddr < 0 || c.Connections.MessageSize < 1 || c.Connections.Violations < 1 {
+		return errors.New("Invalid connection limits")
+	}
+
+	if _, err := ParseNetworks(c.Connections.TrustedProxies); err != nil {
+		return fmt.Errorf("Invalid trusted proxies: %w", err)
+	}
+
+	tokens := make(map[string]bool)
+
+	for name, token := range c.BotTokens {
+		if name == "" || token == "" || tokens[token] {
+			return fmt.Errorf("Bot accounts need a name and a token of their own, got %q", name)
+		}
+		tokens[token] = true
+	}
+
+	if c.StoragePath == "" {
+		return errors.New("Missing storage path")
+	}
+
+	switch c.LogLevel {
+	case LogDebug, LogInfo, LogWarn, LogError:
+	default:
+		return fmt.Errorf("Unknown log level %q", c.LogLevel)
+	}
+
+	return nil
+}
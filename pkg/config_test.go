@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	config, err := ParseConfig([]string{}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(config, DefaultConfig()) {
+		t.Errorf("Expected defaults, got %+v", config)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	os.WriteFile(path, []byte(`{
+		"listen": "127.0.0.1:9000",
+		"storage_path": "/var/lib/chess",
+		"timeouts": {"match": "20s", "abort": "1m"},
+		"time_controls": [{"name": "3+2 Blitz", "duration": "3m", "increment": "2s"}]
+	}`), 0644)
+
+	config, err := ParseConfig([]string{"-config", path, "-listen", ":443"}, env(map[string]string{
+		"CHESS_LISTEN":        "127.0.0.1:9001",
+		"CHESS_MATCH_TIMEOUT": "30s",
+		"CHESS_LOG_LEVEL":     "debug",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Listen != ":443" {
+		t.Errorf("Expected flag to win, got %v", config.Listen)
+	}
+	if config.Timeouts.Match != Duration(30*time.Second) {
+		t.Errorf("Expected env to override the file, got %v", config.Timeouts.Match)
+	}
+	if config.Timeouts.Abort != Duration(time.Minute) {
+		t.Errorf("Expected abort timeout from file, got %v", config.Timeouts.Abort)
+	}
+	if config.Timeouts.Challenge != Duration(5*time.Minute) {
+		t.Errorf("Expected default challenge timeout, got %v", config.Timeouts.Challenge)
+	}
+	if config.StoragePath != "/var/lib/chess" || config.LogLevel != LogDebug {
+		t.Errorf("Expected storage and log level to be set, got %+v", config)
+	}
+	if len(config.TimeControls) != 1 || config.TimeControls[0].Duration != "3m" {
+		t.Errorf("Expected a single 3m time control, got %v", config.TimeControls)
+	}
+}
+
+func TestConnectionOverrides(t *testing.T) {
+	config, err := ParseConfig([]string{"-violations", "5", "-uci-engine", "/usr/games/stockfish"}, env(map[string]string{
+		"CHESS_ORIGINS":            "https://a.example.com,https://b.example.com",
+		"CHESS_ADDR_MESSAGE_RATE":  "40",
+		"CHESS_ADDR_MESSAGE_BURST": "80",
+		"CHESS_MESSAGE_SIZE":       "8192",
+		"CHESS_VIOLATIONS":         "2",
+		"CHESS_BOT_TOKENS":         "engine:secret,other:secret2",
+		"CHESS_UCI_ENGINE":         "/usr/local/bin/engine",
+		"BOT_TOKENS":               "ignored:secret3",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Origins) != 2 {
+		t.Errorf("Expected two origins, got %v", config.Origins)
+	}
+	if config.RateLimits.Addresses != (RateLimit{Rate: 40, Burst: 80}) {
+		t.Errorf("Expected address rate limit from env, got %+v", config.RateLimits.Addresses)
+	}
+	if config.Connections.MessageSize != 8192 {
+		t.Errorf("Expected message size from env, got %v", config.Connections.MessageSize)
+	}
+	if config.Connections.Violations != 5 {
+		t.Errorf("Expected flag to override violations, got %v", config.Connections.Violations)
+	}
+	if !reflect.DeepEqual(config.BotTokens, map[string]string{"engine": "secret", "other": "secret2"}) {
+		t.Errorf("Expected bot tokens from env, got %v", config.BotTokens)
+	}
+	if config.UCIEngine != "/usr/games/stockfish" {
+		t.Errorf("Expected flag to override the engine, got %v", config.UCIEngine)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for name, values := range map[string]map[string]string{
+		"tls cert without key": {"CHESS_TLS_CERT": "cert.pem"},
+		"unknown log level":    {"CHESS_LOG_LEVEL": "verbose"},
+		"negative timeout":     {"CHESS_ABORT_TIMEOUT": "-1s"},
+		"unparsable timeout":   {"CHESS_MATCH_TIMEOUT": "soon"},
+		"empty chat burst":     {"CHESS_CHAT_BURST": "0"},
+		"empty message burst":  {"CHESS_MESSAGE_BURST": "0"},
+		"negative connections": {"CHESS_CONNECTIONS_PER_ADDR": "-1"},
+		"invalid proxy":        {"CHESS_TRUSTED_PROXIES": "10.0.0.1,proxy.local"},
+		"empty address burst":  {"CHESS_ADDR_MESSAGE_BURST": "0"},
+		"unparsable size":      {"CHESS_MESSAGE_SIZE": "big"},
+		"malformed bot tokens": {"CHESS_BOT_TOKENS": "engine"},
+		"shared bot tokens":    {"CHESS_BOT_TOKENS": "engine:secret,other:secret"},
+	} {
+		if _, err := ParseConfig([]string{}, env(values)); err == nil {
+			t.Errorf("Expected %v to be rejected", name)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"time_controls": [{"name": "Forever", "duration": "forever"}]}`), 0644)
+
+	if _, err := ParseConfig([]string{"-config", path}, env(nil)); err == nil {
+		t.Error("Expected invalid time control to be rejected")
+	}
+
+	os.WriteFile(path, []byte(`{"time_controls": [{"duration": "3m", "increment": "2s"}]}`), 0644)
+
+	if _, err := ParseConfig([]string{"-config", path}, env(nil)); err == nil {
+		t.Error("Expected unnamed time control to be rejected")
+	}
+}
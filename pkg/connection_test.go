@@ -1,12 +1,18 @@
 package pkg
 
 import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func StartServer(handlers []Handler) *Server {
-	server := NewServer(handlers)
+	server := NewServer(NewBus(), handlers)
 	go server.Listen("0.0.0.0:8080")
 
 	// ...
@@ -17,7 +23,7 @@ func StartServer(handlers []Handler) *Server {
 
 func TestAcceptsConnection(t *testing.T) {
 	server := StartServer([]Handler{})
-	defer server.Shutdown()
+	defer server.Shutdown(context.Background())
 
 	_, err := NewClient()
 
@@ -28,7 +34,7 @@ func TestAcceptsConnection(t *testing.T) {
 
 func TestShutdown(t *testing.T) {
 	server := StartServer([]Handler{})
-	server.Shutdown()
+	server.Shutdown(context.Background())
 
 	_, err := NewClient()
 
@@ -39,7 +45,7 @@ func TestShutdown(t *testing.T) {
 
 func TestHandleConnection(t *testing.T) {
 	server := StartServer([]Handler{})
-	defer server.Shutdown()
+	defer server.Shutdown(context.Background())
 
 	_, err := NewClient()
 
@@ -47,3 +53,211 @@ func TestHandleConnection(t *testing.T) {
 		t.Errorf("Expected connection, got error: %+v", err)
 	}
 }
+
+func TestRejectsInvalidBotToken(t *testing.T) {
+	server := StartServer([]Handler{})
+	defer server.Shutdown(context.Background())
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer wrong")
+
+	_, res, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", header)
+
+	if err == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected connection to be refused")
+	}
+}
+
+func TestRefusesSecondConnectionOnAccount(t *testing.T) {
+	server := StartServer([]Handler{})
+	defer server.Shutdown(context.Background())
+
+	server.Accounts().Add("engine", "token")
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+
+	// both dial at once, only one may get through
+	results := make(chan *websocket.Conn, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			socket, _, _ := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", header)
+			results <- socket
+		}()
+	}
+
+	connected := 0
+
+	for i := 0; i < 2; i++ {
+		if socket := <-results; socket != nil {
+			connected++
+			defer socket.Close()
+		}
+	}
+
+	if connected != 1 {
+		t.Fatalf("Expected one connection on the account, got %v", connected)
+	}
+
+	_, res, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", header)
+	if err == nil || res.StatusCode != http.StatusConflict {
+		t.Error("Expected another connection to be refused")
+	}
+}
+
+func TestFloodingDisconnects(t *testing.T) {
+	server := StartServer([]Handler{})
+	defer server.Shutdown(context.Background())
+
+	server.SetMessageLimits(RateLimit{Rate: 0.001, Burst: 2}, RateLimit{Rate: 100, Burst: 100})
+	server.SetConnectionLimits(ConnectionLimits{PerAddr: 10, MessageSize: 4096, Violations: 1})
+
+	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	for i := 0; i < 5; i++ {
+		socket.WriteJSON(Message{Type: ListQueues})
+	}
+
+	socket.SetReadDeadline(time.Now().Add(time.Second))
+
+	var response Response
+	if err := socket.ReadJSON(&response); err != nil || response.Type != Error {
+		t.Fatalf("Expected a warning first, got %+v %v", response, err)
+	}
+
+	err = socket.ReadJSON(&response)
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("Expected to be disconnected for flooding, got %v", err)
+	}
+
+	// let the player go before reconnecting
+	for start := time.Now(); len(server.Players()) > 0 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	socket, _, err = websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	for i := 0; i < 3; i++ {
+		socket.WriteJSON(Message{Type: ListQueues})
+	}
+
+	socket.SetReadDeadline(time.Now().Add(time.Second))
+
+	err = socket.ReadJSON(&response)
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("Expected violations to outlive the connection, got %+v %v", response, err)
+	}
+
+	// let the player go before shutting down
+	for start := time.Now(); len(server.Players()) > 0 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectionsPerAddr(t *testing.T) {
+	server := StartServer([]Handler{})
+	defer server.Shutdown(context.Background())
+
+	server.SetConnectionLimits(ConnectionLimits{PerAddr: 1, MessageSize: 4096, Violations: 1})
+
+	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	_, res, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err == nil || res.StatusCode != http.StatusTooManyRequests {
+		t.Error("Expected second connection to be refused")
+	}
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	server := StartServer([]Handler{})
+	defer server.Shutdown(context.Background())
+
+	server.SetConnectionLimits(ConnectionLimits{PerAddr: 10, MessageSize: 64, Violations: 1})
+
+	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	socket.WriteJSON(Message{Type: Chat, Text: strings.Repeat("a", 100)})
+	socket.SetReadDeadline(time.Now().Add(time.Second))
+
+	var response Response
+	err = socket.ReadJSON(&response)
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected oversized message to close the connection, got %v", err)
+	}
+}
+
+func TestMalformedMessagesAreRefused(t *testing.T) {
+	bus := NewBus()
+	server := StartServer([]Handler{NewGameManager(bus), NewMatchMaker(bus, time.Second)})
+	defer server.Shutdown(context.Background())
+
+	socket, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	for frame, text := range map[string]string{
+		`{"type": "create_game", "payload": {}}`:     "Unknown message type",
+		`{"type": "match_found", "payload": {}}`:     "Unknown message type",
+		`{"type": "resign", "payload": 5}`:           "Invalid game id",
+		`{"type": "match_confirmed", "payload": 5}`:  "Invalid match id",
+		`{"type": "match_declined", "payload": [1]}`: "Invalid match id",
+	} {
+		socket.WriteMessage(websocket.TextMessage, []byte(frame))
+		socket.SetReadDeadline(time.Now().Add(time.Second))
+
+		var res Response
+		if err := socket.ReadJSON(&res); err != nil {
+			t.Fatalf("Expected an error for %v, got %v", frame, err)
+		}
+
+		if res.Type != Error || res.Text != text {
+			t.Errorf("Expected %q for %v, got %+v", text, frame, res)
+		}
+	}
+}
+
+func TestPongNeedsOutstandingPing(t *testing.T) {
+	player := NewTestPlayer()
+
+	sent := time.Now().Add(-time.Hour).UnixNano()
+	player.Pong(strconv.FormatInt(sent, 10))
+
+	if player.Latency() != 0 {
+		t.Errorf("Expected unsolicited pong to be ignored, got %v", player.Latency())
+	}
+
+	nonce := player.nextPing()
+	time.Sleep(10 * time.Millisecond)
+	player.Pong(nonce)
+
+	latency := player.Latency()
+	if latency < 10*time.Millisecond || latency > PING_INTERVAL {
+		t.Errorf("Expected the ping's round trip, got %v", latency)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	player.Pong(nonce)
+
+	if player.Latency() != latency {
+		t.Errorf("Expected a replayed pong to be ignored, got %v", player.Latency())
+	}
+}
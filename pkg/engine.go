@@ -0,0 +1,325 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Score of a won position, faster wins score higher
+const MATE_SCORE = 100000
+
+// Material in centipawns
+var pieceValues = map[string]int{
+	"p": 100,
+	"N": 320,
+	"B": 330,
+	"R": 500,
+	"Q": 900,
+	"K": 0,
+}
+
+// Bonus for each piece depending on its square, from white's
+// point of view with the eighth rank first
+var pieceSquares = map[string][64]int{
+	"p": {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	"N": {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	"B": {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	"R": {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	"Q": {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	"K": {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+}
+
+type EngineMove struct {
+	From string
+	To   string
+}
+
+// Position reached by a legal move
+type candidate struct {
+	move     EngineMove
+	board    *Board
+	captured int
+}
+
+// Alpha-beta search over the board, looking Depth moves ahead
+// or as deep as it gets within MoveTime
+type Engine struct {
+	Depth    int
+	MoveTime time.Duration
+
+	deadline time.Time
+}
+
+func NewEngine(depth int, moveTime time.Duration) *Engine {
+	return &Engine{
+		Depth:    depth,
+		MoveTime: moveTime,
+	}
+}
+
+func (e *Engine) BestMove(position Position) (EngineMove, bool) {
+	return e.Search(position.Board, position.Color)
+}
+
+// Every variant is played through the board's rules
+func (e *Engine) Supports(variant string) bool {
+	return true
+}
+
+func (e *Engine) Close() error {
+	return nil
+}
+
+// Best move for color, false when there are no legal moves
+func (e *Engine) Search(board *Board, color Color) (EngineMove, bool) {
+	e.deadline = time.Now().Add(e.MoveTime)
+
+	candidates := legalMoves(board, color)
+	if len(candidates) == 0 {
+		return EngineMove{}, false
+	}
+
+	best := candidates[0].move
+
+	// deepen one move at a time so there's always an answer
+	// when time runs out, searching the last best move first
+	for depth := 1; depth <= e.Depth; depth++ {
+		move, completed := e.searchRoot(candidates, color, depth)
+
+		if !completed {
+			break
+		}
+
+		best = move
+
+		for i, c := range candidates {
+			if c.move == best {
+				candidates[0], candidates[i] = candidates[i], candidates[0]
+				break
+			}
+		}
+	}
+
+	return best, true
+}
+
+func (e *Engine) searchRoot(candidates []candidate, color Color, depth int) (EngineMove, bool) {
+	alpha := -MATE_SCORE * 2
+	beta := MATE_SCORE * 2
+	best := candidates[0].move
+
+	for _, c := range candidates {
+		score, completed := e.score(c, color, depth, alpha, beta)
+
+		if !completed {
+			return best, false
+		}
+
+		if score > alpha {
+			alpha = score
+			best = c.move
+		}
+	}
+
+	return best, true
+}
+
+// Score of the position after candidate from color's point of view
+func (e *Engine) score(c candidate, color Color, depth, alpha, beta int) (int, bool) {
+	if winner, _, over := c.board.Variant().Winner(c.board, color); over {
+		if winner == color {
+			return MATE_SCORE + depth, true
+		}
+		return -MATE_SCORE - depth, true
+	}
+
+	score, completed := e.negamax(c.board, opponent(color), depth-1, -beta, -alpha)
+	return -score, completed
+}
+
+func (e *Engine) negamax(board *Board, color Color, depth, alpha, beta int) (int, bool) {
+	if time.Now().After(e.deadline) {
+		return 0, false
+	}
+
+	if depth == 0 {
+		return Evaluate(board, color), true
+	}
+
+	candidates := legalMoves(board, color)
+
+	if len(candidates) == 0 {
+		if inCheck(board, color) {
+			return -MATE_SCORE - depth, true
+		}
+		return 0, true
+	}
+
+	for _, c := range candidates {
+		score, completed := e.score(c, color, depth, alpha, beta)
+
+		if !completed {
+			return 0, false
+		}
+
+		if score >= beta {
+			return beta, true
+		}
+
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return alpha, true
+}
+
+// Material and piece placement of color minus the opponent's
+func Evaluate(board *Board, color Color) int {
+	score := 0
+
+	for row := 0; row < 8; row++ {
+		for col := 'a'; col <= 'h'; col++ {
+			piece := board.matrix[row][col]
+
+			if piece == Empty() {
+				continue
+			}
+
+			index := (7-row)*8 + int(col-'a')
+			if piece.Color == Black {
+				index = row*8 + int(col-'a')
+			}
+
+			value := pieceValues[piece.Notation] + pieceSquares[piece.Notation][index]
+
+			if piece.Color == color {
+				score += value
+			} else {
+				score -= value
+			}
+		}
+	}
+
+	return score
+}
+
+func inCheck(board *Board, color Color) bool {
+	king := board.KingSquare(color)
+	return king != "" && len(board.IsThreatened(king, color)) > 0
+}
+
+// Moves of color that don't leave its own king in check,
+// captures of the most valuable pieces first
+func legalMoves(board *Board, color Color) []candidate {
+	candidates := []candidate{}
+
+	for row := 0; row < 8; row++ {
+		for col := 'a'; col <= 'h'; col++ {
+			piece := board.matrix[row][col]
+
+			if piece == Empty() || piece.Color != color {
+				continue
+			}
+
+			from := fmt.Sprintf("%c%d", col, row+1)
+
+			for toRow := 0; toRow < 8; toRow++ {
+				for toCol := 'a'; toCol <= 'h'; toCol++ {
+					to := fmt.Sprintf("%c%d", toCol, toRow+1)
+
+					if from == to || !piece.Movement.IsValid(from, to) {
+						continue
+					}
+
+					target := board.matrix[toRow][toCol]
+					if target != Empty() && target.Color == color && !piece.king {
+						continue
+					}
+
+					next := board.Clone()
+					if len(next.Move(from, to)) == 0 {
+						continue
+					}
+
+					// atomic captures may blow up the king
+					if next.KingSquare(color) == "" || inCheck(next, color) {
+						continue
+					}
+
+					captured := 0
+					if target != Empty() && target.Color != color {
+						captured = pieceValues[target.Notation]
+					}
+
+					candidates = append(candidates, candidate{
+						move:     EngineMove{From: from, To: to},
+						board:    next,
+						captured: captured,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].captured > candidates[j].captured
+	})
+
+	return candidates
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func emptyBoard() *Board {
+	board := NewBoard()
+
+	for row := 0; row < 8; row++ {
+		for col := 'a'; col <= 'h'; col++ {
+			board.matrix[row][col] = Empty()
+		}
+	}
+
+	return board
+}
+
+func TestEvaluateStartingPosition(t *testing.T) {
+	board := NewBoard()
+
+	if Evaluate(board, White) != 0 || Evaluate(board, Black) != 0 {
+		t.Errorf("Expected even position, got %v", Evaluate(board, White))
+	}
+
+	board.matrix[0]['d'] = Empty()
+
+	if Evaluate(board, White) >= 0 {
+		t.Errorf("Expected white to be worse without the queen, got %v", Evaluate(board, White))
+	}
+}
+
+func TestEngineCapturesHangingQueen(t *testing.T) {
+	board := NewBoard()
+	board.matrix[3]['d'] = Queen(Black)
+	board.matrix[1]['e'] = Empty()
+	board.matrix[2]['e'] = Pawn(White)
+
+	move, ok := NewEngine(2, time.Second).Search(board, White)
+
+	if !ok || move.To != "d4" {
+		t.Errorf("Expected pawn to take the queen, got %+v", move)
+	}
+}
+
+func TestEngineFindsMateInOne(t *testing.T) {
+	board := emptyBoard()
+	board.matrix[7]['g'] = King(Black)
+	board.matrix[6]['f'] = Pawn(Black)
+	board.matrix[6]['g'] = Pawn(Black)
+	board.matrix[6]['h'] = Pawn(Black)
+	board.matrix[0]['g'] = King(White)
+	board.matrix[0]['a'] = Rook(White)
+
+	move, ok := NewEngine(2, 5*time.Second).Search(board, White)
+
+	if !ok || move.From != "a1" || move.To != "a8" {
+		t.Errorf("Expected back rank mate, got %+v", move)
+	}
+}
+
+func TestEngineDoesNotLeaveKingInCheck(t *testing.T) {
+	board := emptyBoard()
+	board.matrix[0]['e'] = King(White)
+	board.matrix[1]['e'] = Rook(White)
+	board.matrix[7]['e'] = Rook(Black)
+	board.matrix[7]['a'] = King(Black)
+
+	for _, c := range legalMoves(board, White) {
+		if c.move.From == "e2" && c.move.To[0] != 'e' {
+			t.Errorf("Expected pinned rook to stay on the file, got %+v", c.move)
+		}
+	}
+}
+
+func TestEngineWithoutMoves(t *testing.T) {
+	board := emptyBoard()
+	board.matrix[7]['a'] = King(Black)
+	board.matrix[5]['b'] = Queen(White)
+	board.matrix[0]['h'] = King(White)
+
+	if _, ok := NewEngine(1, time.Second).Search(board, Black); ok {
+		t.Error("Expected stalemated side to have no moves")
+	}
+}
@@ -1,8 +1,12 @@
 package pkg
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -14,6 +18,34 @@ const (
 	White Color = "white"
 )
 
+const (
+	PlayersChannel    = "players"
+	SpectatorsChannel = "spectators"
+)
+
+// Most lag credited back to a player on each move
+const MAX_LAG_COMPENSATION = 500 * time.Millisecond
+
+// How long each player has to make their first move
+// before the game is aborted
+const ABORT_TIMEOUT = 30 * time.Second
+
+// Shortest abort window, short time controls get their starting
+// time to make the first move but no less than this
+const MIN_ABORT_TIMEOUT = 5 * time.Second
+
+// How long players who let a game abort wait in queues
+const ABORT_PENALTY = 2 * time.Minute
+
+// How long players of games suspended on shutdown have to come back
+const RESUME_TIMEOUT = 2 * time.Minute
+
+const (
+	MAX_CHAT_LENGTH = 200
+	CHAT_RATE       = 1
+	CHAT_BURST      = 5
+)
+
 type GameResult struct {
 	Winner *Player
 	Loser  *Player
@@ -27,32 +59,25 @@ type GamePlayer struct {
 	King        string
 	TimeControl TimeControl
 
-	start time.Time
-	left  time.Duration
-	timer *time.Timer
-	mutex *sync.Mutex
-}
-
-func NewGamePlayer(color Color, player *Player, timeControl TimeControl) *GamePlayer {
-	duration, _ := time.ParseDuration(timeControl.Duration)
-	timer := time.NewTimer(duration)
-	timer.Stop()
+	muted bool
+	clock *Clock
 
-	king := "e1"
-
-	if color == Black {
-		king = "e8"
-	}
+	// correspondence players may leave and come back
+	token   string
+	offline bool
+	mutex   *sync.Mutex
+}
 
+// Players of a game share its clock
+func NewGamePlayer(color Color, player *Player, timeControl TimeControl, king string, clock *Clock) *GamePlayer {
 	return &GamePlayer{
 		Player:      player,
 		Color:       color,
 		King:        king,
 		TimeControl: timeControl,
 
+		clock: clock,
 		mutex: new(sync.Mutex),
-		left:  duration,
-		timer: timer,
 	}
 }
 
@@ -66,40 +91,113 @@ func (p *GamePlayer) SetNext(player *GamePlayer) {
 	p.Next = player
 }
 
+// Don't flag before the move had a chance to make it through
 func (p *GamePlayer) StartTimer() {
+	p.clock.Start(p.Color, p.compensation())
+}
+
+// Lag credited for the running turn, the connection's round trip
+// covers sending the turn to the client and the move back
+func (p *GamePlayer) compensation() time.Duration {
+	lag := p.Player.Latency()
+
+	if lag > MAX_LAG_COMPENSATION {
+		lag = MAX_LAG_COMPENSATION
+	}
+
+	return lag
+}
+
+// Lag credited back to the player during the game
+func (p *GamePlayer) Compensated() time.Duration {
+	return p.clock.Compensated(p.Color)
+}
+
+// Whether the player's time ran out before they stopped it
+func (p *GamePlayer) StopTimer() bool {
+	return p.clock.Stop(p.Color, p.compensation())
+}
+
+// Time left on the player's clock, including the running turn
+func (p *GamePlayer) TimeLeft() time.Duration {
+	return p.clock.Remaining(p.Color)
+}
+
+// Responses to players who left a correspondence game are dropped,
+// they catch up with the game's state when they resume
+func (p *GamePlayer) Send(response Response) {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	player := p.Player
+	offline := p.offline
+	p.mutex.Unlock()
 
-	p.start = time.Now()
-	p.timer.Reset(p.left)
+	if !offline {
+		player.Send(response)
+	}
 }
 
-func (p *GamePlayer) StopTimer() {
+// Lets the player resume the game, empty for live games until
+// they're suspended
+func (p *GamePlayer) Token() string {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	p.timer.Stop()
-
-	increment, _ := time.ParseDuration(p.TimeControl.Increment)
-	p.left = p.left - time.Since(p.start) + increment
+	return p.token
 }
 
-func (p *GamePlayer) Send(response Response) {
-	p.Player.Send(response)
+func (p *GamePlayer) IsOffline() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.offline
 }
 
+// Game is played on its own goroutine, see Do. Only that goroutine
+// writes Current, board and moves, it takes mutex to do so since
+// others read them for states and summaries, and reads them without
+// it. Start, which may run outside Do, takes it too. The rest of
+// the fields mutex guards are shared: over, chat, limits and
+// spectators.
 type Game struct {
 	Id      uuid.UUID
 	Current *GamePlayer
 	Over    chan GameResult
 
-	board *Board
-	mutex *sync.Mutex
+	started    time.Time
+	restored   bool
+	suspending bool
+	opening    bool
+	rank       string
+	board      *Board
+	variant    Variant
+	clock      *Clock
+	over       bool
+	chatLimit  RateLimit
+	inbox      chan func()
+	done       chan bool
+	moves      []string
+	chat       []ChatLine
+	limits     map[*Player]*RateLimiter
+	mutex      *sync.Mutex
+	spectators map[*Player]*Spectator
 }
 
-func NewGame(players []*Player, timeControl TimeControl) *Game {
-	white := NewGamePlayer(White, players[0], timeControl)
-	black := NewGamePlayer(Black, players[1], timeControl)
+// Players are expected white first, see ColorPolicy
+func NewGame(players []*Player, timeControl TimeControl) (*Game, error) {
+	if !IsVariant(timeControl.Variant) {
+		return nil, fmt.Errorf("Unknown variant %q", timeControl.Variant)
+	}
+
+	clock, err := NewClock(timeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := NewVariant(timeControl.Variant)
+	board := variant.NewBoard()
+
+	white := NewGamePlayer(White, players[0], timeControl, board.KingSquare(White), clock)
+	black := NewGamePlayer(Black, players[1], timeControl, board.KingSquare(Black), clock)
 
 	white.SetNext(black)
 
@@ -108,26 +206,102 @@ func NewGame(players []*Player, timeControl TimeControl) *Game {
 		Over:    make(chan GameResult),
 		Current: white,
 
-		board: NewBoard(),
-		mutex: new(sync.Mutex),
+		started:    time.Now(),
+		rank:       board.Rank(),
+		board:      board,
+		variant:    variant,
+		clock:      clock,
+		moves:      []string{},
+		chat:       []ChatLine{},
+		limits:     make(map[*Player]*RateLimiter),
+		mutex:      new(sync.Mutex),
+		spectators: make(map[*Player]*Spectator),
+		chatLimit:  RateLimit{Rate: CHAT_RATE, Burst: CHAT_BURST},
+		inbox:      make(chan func()),
+		done:       make(chan bool),
 	}
 
+	go game.run()
+
 	go func() {
+		<-clock.Done()
+
 		select {
-		case <-white.timer.C:
-			game.GameOver(white.Player, "Timeout")
-		case <-black.timer.C:
-			game.GameOver(black.Player, "Timeout")
+		case color := <-clock.Flag():
+			if color == White {
+				game.GameOver(white.Player, "Timeout")
+			} else {
+				game.GameOver(black.Player, "Timeout")
+			}
+		default:
 		}
 	}()
 
-	return game
+	return game, nil
 }
 
-func (g *Game) GameOver(loser *Player, reason string) {
+// Everything that changes the game's outcome runs here one
+// at a time, until the game is over
+func (g *Game) run() {
+	defer close(g.done)
+
+	for command := range g.inbox {
+		command()
+
+		if g.IsOver() {
+			return
+		}
+	}
+}
+
+// Run command on the game's goroutine and wait for it, returns
+// false without running it if the game is already over. Commands
+// must not call Do themselves.
+func (g *Game) Do(command func()) bool {
+	if g.IsOver() {
+		return false
+	}
+
+	finished := make(chan bool)
+
+	select {
+	case g.inbox <- func() {
+		command()
+		close(finished)
+	}:
+		<-finished
+		return true
+	case <-g.done:
+		return false
+	}
+}
+
+func (g *Game) IsOver() bool {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	return g.over
+}
+
+// End the game from outside its goroutine, e.g. on resignation
+func (g *Game) GameOver(loser *Player, reason string) {
+	g.Do(func() {
+		g.end(loser, reason)
+	})
+}
+
+// End the game once, from the game's goroutine
+func (g *Game) end(loser *Player, reason string) {
+	g.mutex.Lock()
+
+	if g.over {
+		g.mutex.Unlock()
+		return
+	}
+
+	g.over = true
+	g.clock.Close()
+
 	winner := g.Current.Player
 
 	if winner == loser {
@@ -138,6 +312,14 @@ func (g *Game) GameOver(loser *Player, reason string) {
 		loser = nil
 	}
 
+	// aborted and suspended games have no result
+	if reason == "Aborted" || reason == "Suspended" {
+		winner = nil
+		loser = nil
+	}
+
+	g.mutex.Unlock()
+
 	g.Over <- GameResult{
 		Loser:  loser,
 		Winner: winner,
@@ -145,19 +327,62 @@ func (g *Game) GameOver(loser *Player, reason string) {
 	}
 }
 
-func (g *Game) EndTurn() {
+// Abort the game if no move was played since moves were on
+// the board, holding the player who didn't move back for penalty
+// before anyone hears of it, returns whether it was aborted
+func (g *Game) Abort(moves int, penalty time.Duration) bool {
+	aborted := false
+
+	g.Do(func() {
+		if len(g.Moves()) != moves {
+			return
+		}
+
+		g.Current.Player.Penalize(penalty)
+		g.Current.StopTimer()
+		g.end(nil, "Aborted")
+
+		aborted = true
+	})
+
+	return aborted
+}
+
+// Pass the turn, returns whether the player flagged before moving
+func (g *Game) EndTurn() bool {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	g.Current.StopTimer()
+	flagged := g.Current.StopTimer()
 	g.Current = g.Current.Next
+
+	return flagged
+}
+
+// Hold the clock, e.g. while an arbiter looks into the game
+func (g *Game) PauseClock() {
+	g.clock.Pause()
+}
+
+func (g *Game) ResumeClock() {
+	g.clock.Resume()
 }
 
 func (g *Game) StartTurn() {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	if g.clockStarted() {
+		g.Current.StartTimer()
+	}
+}
+
+// Clocks waiting for the opening run once each side made its first move
+func (g *Game) clockStarted() bool {
+	return !g.opening || len(g.moves) >= MAX_PLAYERS
+}
 
-	g.Current.StartTimer()
+// Keep live clocks from running before each side's first move,
+// which is left to the abort timeout instead
+func (g *Game) WaitForOpening() {
+	g.opening = !g.IsCorrespondence()
 }
 
 func (g *Game) Move(from, to string) []AllowedMove {
@@ -168,8 +393,13 @@ func (g *Game) Move(from, to string) []AllowedMove {
 	if piece != Empty() && piece.Color == g.Current.Color {
 		moves := g.board.Move(from, to)
 
-		if piece.king {
-			g.Current.King = to
+		if len(moves) > 0 {
+			// castling may name the rook's square as destination
+			if piece.king {
+				g.Current.King = moves[0].To.String()
+			}
+
+			g.moves = append(g.moves, from+moves[0].To.String())
 		}
 
 		return moves
@@ -178,10 +408,43 @@ func (g *Game) Move(from, to string) []AllowedMove {
 	return []AllowedMove{}
 }
 
-func (g *Game) IsCheckmate() bool {
+// Put a piece from the current player's reserve on the board
+func (g *Game) Drop(notation, to string) error {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	err := g.variant.Drop(g.board, g.Current.Color, notation, to)
+
+	if err == nil {
+		g.moves = append(g.moves, strings.ToUpper(notation)+"@"+to)
+	}
+
+	return err
+}
+
+// End the game if the variant's extra win conditions are met
+// by the player who just moved
+func (g *Game) VariantWin() bool {
+	winner, reason, over := g.variant.Winner(g.board, g.Current.Next.Color)
+
+	if !over {
+		return false
+	}
+
+	loser := g.Current.Player
+	if g.Current.Color == winner {
+		loser = g.Current.Next.Player
+	}
+
+	g.Current.StopTimer()
+	g.Current.Next.StopTimer()
+
+	g.end(loser, reason)
+
+	return true
+}
+
+func (g *Game) IsCheckmate() bool {
 	king := g.board.Square(g.Current.King)
 
 	threatened := g.board.IsThreatened(g.Current.King, king.Color)
@@ -192,13 +455,10 @@ func (g *Game) IsCheckmate() bool {
 }
 
 func (g *Game) Checkmate() {
-	g.mutex.Lock()
-
 	g.Current.StopTimer()
 	g.Current.Next.StopTimer()
 
-	g.mutex.Unlock()
-	g.GameOver(g.Current.Player, "Checkmate")
+	g.end(g.Current.Player, "Checkmate")
 }
 
 // TODO: register game as a listener
@@ -219,11 +479,496 @@ func (g *Game) Start() {
 				GameId:      g.Id,
 				Color:       player.Color,
 				TimeControl: player.TimeControl,
+				Fen:         g.fen(),
+				Token:       player.Token(),
 			},
 		})
 
 		players[player] = player
 	}
 
-	g.Current.StartTimer()
+	if g.clockStarted() {
+		g.Current.StartTimer()
+	}
+}
+
+func (g *Game) IsCorrespondence() bool {
+	return g.clock.IsCorrespondence()
+}
+
+// When the player to move runs out of time
+func (g *Game) Deadline() time.Time {
+	return time.Now().Add(g.Current.TimeLeft())
+}
+
+// Send to player unless they left a correspondence game
+func (g *Game) SendTo(player *Player, response Response) {
+	for _, p := range g.Players() {
+		if p.Player == player {
+			p.Send(response)
+			return
+		}
+	}
+}
+
+// Keep player's seat while they're away from a correspondence game
+func (g *Game) Detach(player *Player) bool {
+	for _, p := range g.Players() {
+		p.mutex.Lock()
+		found := p.Player == player
+		if found {
+			p.offline = true
+		}
+		p.mutex.Unlock()
+
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Give the seat with token back to player, returns nil if
+// the token doesn't match any
+func (g *Game) Attach(player *Player, token string) *GamePlayer {
+	if token == "" {
+		return nil
+	}
+
+	for _, p := range g.Players() {
+		p.mutex.Lock()
+		found := p.token == token
+		if found {
+			p.Player = player
+			p.offline = false
+		}
+		p.mutex.Unlock()
+
+		if found {
+			return p
+		}
+	}
+	return nil
+}
+
+// Stop the clock and hand out tokens so players can resume the
+// game after a restart, from the game's goroutine
+func (g *Game) Suspend() (GameRecord, error) {
+	if err := g.IssueTokens(); err != nil {
+		return GameRecord{}, err
+	}
+
+	g.clock.Pause()
+
+	record := g.Record()
+	g.end(nil, "Suspended")
+
+	return record, nil
+}
+
+// Hand out the tokens players resume the game with, those
+// they have already are kept
+func (g *Game) IssueTokens() error {
+	for _, p := range g.Players() {
+		p.mutex.Lock()
+
+		if p.token == "" {
+			token, err := NewToken()
+			if err != nil {
+				p.mutex.Unlock()
+				return err
+			}
+			p.token = token
+		}
+
+		p.mutex.Unlock()
+	}
+
+	return nil
+}
+
+// Whether every player is at the board
+func (g *Game) IsAttended() bool {
+	for _, p := range g.Players() {
+		if p.IsOffline() {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot to persist a game
+func (g *Game) Record() GameRecord {
+	players := g.Players()
+	deadline := g.Deadline()
+
+	seat := func(p *GamePlayer) SeatRecord {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		return SeatRecord{
+			Id:     p.Player.Id,
+			Rating: p.Player.Rating,
+			Token:  p.token,
+			Left:   p.TimeLeft(),
+		}
+	}
+
+	return GameRecord{
+		Id:          g.Id,
+		White:       seat(players[0]),
+		Black:       seat(players[1]),
+		TimeControl: players[0].TimeControl,
+		Rank:        g.rank,
+		Moves:       g.Moves(),
+		Deadline:    deadline,
+		StartedAt:   g.started,
+		Chat:        g.ChatHistory(),
+	}
+}
+
+// Bring back a persisted game, both players are away until
+// they resume with their tokens. Games suspended on shutdown keep
+// their clock stopped until then.
+func RestoreGame(record GameRecord) (*Game, error) {
+	players := []*Player{restoredPlayer(record.White), restoredPlayer(record.Black)}
+
+	game, err := NewGame(players, record.TimeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	game.Id = record.Id
+	game.started = record.StartedAt
+	game.restored = true
+	game.chat = record.Chat
+	game.WaitForOpening()
+	game.rank = record.Rank
+	game.board = NewBoardFromRank(record.Rank)
+	game.board.variant = game.variant
+
+	seats := game.Players()
+	for i, seat := range []SeatRecord{record.White, record.Black} {
+		seats[i].King = game.board.KingSquare(seats[i].Color)
+		seats[i].token = seat.Token
+		seats[i].offline = true
+	}
+
+	for _, move := range record.Moves {
+		if err := game.replay(move); err != nil {
+			game.clock.Close()
+			return nil, err
+		}
+		game.Current = game.Current.Next
+	}
+
+	if game.IsCorrespondence() {
+		game.clock.Set(game.Current.Color, time.Until(record.Deadline))
+	} else {
+		game.clock.Set(White, record.White.Left)
+		game.clock.Set(Black, record.Black.Left)
+		game.clock.Pause()
+	}
+
+	game.StartTurn()
+
+	return game, nil
+}
+
+func restoredPlayer(seat SeatRecord) *Player {
+	return &Player{
+		Id:     seat.Id,
+		Rating: seat.Rating,
+		colors: []Color{},
+		mutex:  new(sync.Mutex),
+	}
+}
+
+// Play a recorded move, e2e4 or N@e4 for drops
+func (g *Game) replay(move string) error {
+	if parts := strings.SplitN(move, "@", 2); len(parts) == 2 {
+		return g.Drop(parts[0], parts[1])
+	}
+
+	if len(move) < 4 || len(g.Move(move[0:2], move[2:4])) == 0 {
+		return errors.New("Invalid move " + move)
+	}
+
+	return nil
+}
+
+// Last move played, for players catching up with the game
+func (g *Game) LastMove() (MoveResponse, bool) {
+	moves := g.Moves()
+	if len(moves) == 0 {
+		return MoveResponse{}, false
+	}
+
+	last := moves[len(moves)-1]
+	if parts := strings.SplitN(last, "@", 2); len(parts) == 2 {
+		return MoveResponse{Drop: parts[0], To: parts[1]}, true
+	}
+
+	return MoveResponse{From: last[0:2], To: last[2:4]}, true
+}
+
+// Players of the game, white first
+func (g *Game) Players() []*GamePlayer {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	players := []*GamePlayer{g.Current, g.Current.Next}
+
+	if g.Current.Color == Black {
+		players[0], players[1] = players[1], players[0]
+	}
+
+	return players
+}
+
+func (g *Game) HasPlayer(player *Player) bool {
+	for _, p := range g.Players() {
+		if p.Player == player {
+			return true
+		}
+	}
+	return false
+}
+
+// FEN of the current position, castling and en passant
+// are not tracked by the board so they're always empty
+func (g *Game) FEN() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.fen()
+}
+
+func (g *Game) fen() string {
+	turn := "w"
+	if g.Current.Color == Black {
+		turn = "b"
+	}
+
+	return fmt.Sprintf("%s %s - - 0 %d", g.board.FEN(), turn, len(g.moves)/2+1)
+}
+
+func (g *Game) Moves() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	moves := make([]string, len(g.moves))
+	copy(moves, g.moves)
+
+	return moves
+}
+
+// Snapshot of the game for players joining late
+func (g *Game) State() GameStateResponse {
+	players := g.Players()
+
+	return GameStateResponse{
+		GameId:     g.Id,
+		Fen:        g.FEN(),
+		White:      players[0].TimeLeft().Milliseconds(),
+		Black:      players[1].TimeLeft().Milliseconds(),
+		Moves:      g.Moves(),
+		Spectators: g.Spectators(),
+	}
+}
+
+func (g *Game) AddSpectator(player *Player) *Spectator {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	spectator, ok := g.spectators[player]
+
+	if !ok {
+		spectator = NewSpectator(player, g.resync)
+		g.spectators[player] = spectator
+	}
+
+	return spectator
+}
+
+// Catch spectator up with a fresh state, moves are only played
+// from the game's goroutine so none slips in between
+func (g *Game) resync(spectator *Spectator) {
+	g.Do(func() {
+		spectator.Resync(Response{
+			Type:    GameState,
+			Payload: g.State(),
+		})
+	})
+}
+
+func (g *Game) RemoveSpectator(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	spectator, ok := g.spectators[player]
+
+	if ok {
+		spectator.Close()
+		delete(g.spectators, player)
+	}
+
+	return ok
+}
+
+func (g *Game) IsSpectator(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	_, ok := g.spectators[player]
+	return ok
+}
+
+func (g *Game) Spectators() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return len(g.spectators)
+}
+
+// Send response to every spectator
+func (g *Game) Broadcast(response Response) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, spectator := range g.spectators {
+		spectator.Send(response)
+	}
+}
+
+func (g *Game) CloseSpectators() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for player, spectator := range g.spectators {
+		spectator.Close()
+		delete(g.spectators, player)
+	}
+}
+
+func (g *Game) Summary() GameSummary {
+	players := g.Players()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return GameSummary{
+		GameId: g.Id,
+		White: PlayerSummary{
+			Id:     players[0].Player.Id,
+			Rating: players[0].Player.Rating,
+			Time:   players[0].TimeLeft().Milliseconds(),
+		},
+		Black: PlayerSummary{
+			Id:     players[1].Player.Id,
+			Rating: players[1].Player.Rating,
+			Time:   players[1].TimeLeft().Milliseconds(),
+		},
+		TimeControl: players[0].TimeControl,
+		Moves:       len(g.moves),
+		Turn:        g.Current.Color,
+		Spectators:  len(g.spectators),
+		StartedAt:   g.started,
+	}
+}
+
+// Relay a chat message from player to the channel's audience,
+// players chat with each other and spectators among themselves
+func (g *Game) Chat(player *Player, channel, text string) error {
+	text = strings.TrimSpace(text)
+
+	if player.IsMuted() {
+		return errors.New("Muted by a moderator")
+	}
+	if text == "" {
+		return errors.New("Empty message")
+	}
+	if utf8.RuneCountInString(text) > MAX_CHAT_LENGTH {
+		return errors.New("Message too long")
+	}
+
+	g.mutex.Lock()
+
+	_, spectating := g.spectators[player]
+	playing := g.Current.Player == player || g.Current.Next.Player == player
+
+	if (channel == PlayersChannel && !playing) || (channel == SpectatorsChannel && !spectating) {
+		g.mutex.Unlock()
+		return errors.New("Not allowed to chat on this channel")
+	}
+
+	limiter, ok := g.limits[player]
+	if !ok {
+		limiter = NewRateLimiter(g.chatLimit.Rate, g.chatLimit.Burst)
+		g.limits[player] = limiter
+	}
+
+	if !limiter.Allow() {
+		g.mutex.Unlock()
+		return errors.New("Too many messages")
+	}
+
+	line := ChatLine{
+		GameId:  g.Id,
+		Player:  player.Id,
+		Channel: channel,
+		Text:    text,
+		Time:    time.Now(),
+	}
+	g.chat = append(g.chat, line)
+
+	response := Response{
+		Type:    ChatReceived,
+		Payload: line,
+	}
+
+	recipients := []*GamePlayer{}
+
+	if channel == PlayersChannel {
+		for _, p := range []*GamePlayer{g.Current, g.Current.Next} {
+			if p.Player == player || !p.muted {
+				recipients = append(recipients, p)
+			}
+		}
+	} else {
+		for _, spectator := range g.spectators {
+			spectator.Send(response)
+		}
+	}
+
+	g.mutex.Unlock()
+
+	for _, recipient := range recipients {
+		recipient.Send(response)
+	}
+
+	return nil
+}
+
+// Stop or resume relaying the opponent's messages to player
+func (g *Game) Mute(player *Player, muted bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, p := range []*GamePlayer{g.Current, g.Current.Next} {
+		if p.Player == player {
+			p.muted = muted
+		}
+	}
+}
+
+// Chat history of the game, including the spectators channel
+func (g *Game) ChatHistory() []ChatLine {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	history := make([]ChatLine, len(g.chat))
+	copy(history, g.chat)
+
+	return history
 }
@@ -1,38 +1,496 @@
 package pkg
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mitchellh/mapstructure"
 )
 
+const (
+	SortByRating = "rating"
+	SortByStart  = "start"
+)
+
 type GameManager struct {
-	games map[uuid.UUID]*Game
-	mutex *sync.Mutex
+	bus       *Bus
+	games     map[uuid.UUID]*Game
+	rematches map[uuid.UUID]*Rematch
+	forfeits  map[uuid.UUID]*time.Timer
+	mutex     *sync.Mutex
+	colors    ColorPolicy
+	engines   map[string][]string
+	store     GameStore
+	deadlines *DeadlineScheduler
+	logger    *Logger
+	audit     *AuditLog
+	draining  bool
+	notices   *sync.WaitGroup
+
+	// players with a bot game starting or going on
+	botPlayers map[*Player]bool
+
+	moves       *CounterVec
+	moveLatency *Histogram
+	results     *CounterVec
+
+	rematchTimeout time.Duration
+	abortTimeout   time.Duration
+	resumeTimeout  time.Duration
+	chatLimit      RateLimit
 }
 
-func NewGameManager() *GameManager {
-	return &GameManager{
-		mutex: new(sync.Mutex),
-		games: make(map[uuid.UUID]*Game),
+func NewGameManager(bus *Bus) *GameManager {
+	manager := &GameManager{
+		bus:       bus,
+		mutex:     new(sync.Mutex),
+		games:     make(map[uuid.UUID]*Game),
+		rematches: make(map[uuid.UUID]*Rematch),
+		forfeits:  make(map[uuid.UUID]*time.Timer),
+		colors:    PreferredColors{RandomColors{}},
+		engines:   make(map[string][]string),
+		notices:   new(sync.WaitGroup),
+
+		botPlayers: make(map[*Player]bool),
+
+		rematchTimeout: REMATCH_TIMEOUT,
+		abortTimeout:   ABORT_TIMEOUT,
+		resumeTimeout:  RESUME_TIMEOUT,
+		chatLimit:      RateLimit{Rate: CHAT_RATE, Burst: CHAT_BURST},
+
+		moves:       NewCounterVec(),
+		moveLatency: NewHistogram(LATENCY_BUCKETS),
+		results:     NewCounterVec(),
 	}
+
+	manager.deadlines = NewDeadlineScheduler(manager.Expire)
+
+	return manager
+}
+
+func (g *GameManager) SetTimeouts(timeouts Timeouts) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.rematchTimeout = time.Duration(timeouts.Rematch)
+	g.abortTimeout = time.Duration(timeouts.Abort)
+	g.resumeTimeout = time.Duration(timeouts.Resume)
 }
 
-func (g *GameManager) CreateGame(players []*Player, timeControl TimeControl) *Game {
+// How fast players and spectators may chat in each game
+func (g *GameManager) SetChatLimit(limit RateLimit) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	game := NewGame(players, timeControl)
+	g.chatLimit = limit
+}
+
+// Keep correspondence games in store so they survive restarts
+func (g *GameManager) SetStore(store GameStore) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.store = store
+}
+
+func (g *GameManager) SetLogger(logger *Logger) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.logger = logger
+}
+
+// Record moves and results to audit
+func (g *GameManager) SetAudit(audit *AuditLog) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.audit = audit
+}
+
+func (g *GameManager) log() *Logger {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.logger
+}
+
+// Fails when the store can't take games, stores that can't tell
+// are assumed to be fine
+func (g *GameManager) Check() error {
+	g.mutex.Lock()
+	store := g.store
+	g.mutex.Unlock()
+
+	if checker, ok := store.(Checker); ok {
+		return checker.Check()
+	}
+
+	return nil
+}
+
+// Bring back the correspondence games kept in the store
+func (g *GameManager) Restore() error {
+	g.mutex.Lock()
+	store := g.store
+	g.mutex.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		game, err := RestoreGame(record)
+		if err != nil {
+			return err
+		}
+
+		g.mutex.Lock()
+		g.AddGame(game)
+		if !game.IsCorrespondence() {
+			g.forfeits[game.Id] = time.AfterFunc(g.resumeTimeout, func() {
+				g.ForfeitAbsent(game)
+			})
+		}
+		g.mutex.Unlock()
+
+		g.log().Info("Game restored", "game_id", game.Id, "correspondence", game.IsCorrespondence())
+
+		if game.IsCorrespondence() {
+			g.deadlines.Schedule(game.Id, record.Deadline)
+		}
+	}
+
+	return nil
+}
+
+// End a suspended game players didn't come back to, those who
+// did win by abandonment
+func (g *GameManager) ForfeitAbsent(game *Game) {
+	game.Do(func() {
+		absent := []*Player{}
+		for _, player := range game.Players() {
+			if player.IsOffline() {
+				absent = append(absent, player.Player)
+			}
+		}
+
+		switch len(absent) {
+		case 1:
+			game.end(absent[0], "Abandonment")
+		case 2:
+			game.end(nil, "Aborted")
+		}
+	})
+}
+
+// Players made it back to the suspended game in time
+func (g *GameManager) CancelForfeit(gameId uuid.UUID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if timer, ok := g.forfeits[gameId]; ok {
+		timer.Stop()
+		delete(g.forfeits, gameId)
+	}
+}
+
+// Wait for live games to finish until ctx is done, suspending
+// the rest so they can be resumed after a restart. Correspondence
+// games are already in the store. Rematches are refused meanwhile.
+func (g *GameManager) Drain(ctx context.Context) error {
+	g.mutex.Lock()
+	g.draining = true
+	g.mutex.Unlock()
+
+	for {
+		live := []*Game{}
+
+		g.mutex.Lock()
+		for _, game := range g.games {
+			if !game.IsCorrespondence() {
+				live = append(live, game)
+			}
+		}
+		g.mutex.Unlock()
+
+		if len(live) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			err := g.Suspend(live)
+			g.awaitNotices()
+			return err
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Save games to the store and end them without a result,
+// they're aborted when there's no store to keep them
+func (g *GameManager) Suspend(games []*Game) error {
+	g.mutex.Lock()
+	store := g.store
+	g.mutex.Unlock()
+
+	var err error
+
+	for _, game := range games {
+		game.Do(func() {
+			if game.IsOver() {
+				return
+			}
+
+			// resume tokens and the audit record are written from
+			// AddGame once the game is over
+			game.suspending = true
+			g.notices.Add(1)
+
+			if store == nil {
+				game.end(nil, "Aborted")
+				return
+			}
+
+			record, suspendErr := game.Suspend()
+			if suspendErr != nil {
+				g.log().Error("Suspending game failed", "game_id", game.Id, "error", suspendErr)
+
+				// a game nobody can resume is aborted instead
+				game.end(nil, "Aborted")
+				err = suspendErr
+				return
+			}
+
+			if saveErr := store.Save(record); saveErr != nil {
+				g.log().Error("Suspending game failed", "game_id", game.Id, "error", saveErr)
+				err = saveErr
+			}
+		})
+	}
+
+	return err
+}
+
+// Wait for games ended by Suspend to be told to their players and
+// the audit log, without hanging on players who stopped reading
+func (g *GameManager) awaitNotices() {
+	sent := make(chan bool)
+	go func() {
+		g.notices.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(CLOSE_TIMEOUT):
+		g.log().Warn("Resume tokens still pending")
+	}
+}
+
+// Persist a correspondence game and wake up when its turn runs out
+func (g *GameManager) Save(game *Game) {
+	if !game.IsCorrespondence() {
+		return
+	}
+
+	record := game.Record()
+
+	g.mutex.Lock()
+	store := g.store
+	g.mutex.Unlock()
+
+	if store != nil {
+		if err := store.Save(record); err != nil {
+			g.log().Error("Saving game failed", "game_id", game.Id, "error", err)
+		}
+	}
+
+	g.deadlines.Schedule(game.Id, record.Deadline)
+}
+
+// End a correspondence game whose player to move ran out of days
+func (g *GameManager) Expire(gameId uuid.UUID) {
+	game := g.FindGame(gameId)
+
+	if game == nil {
+		return
+	}
+
+	game.Do(func() {
+		if game.Current.TimeLeft() == 0 {
+			game.end(game.Current.Player, "Timeout")
+		}
+	})
+}
+
+// Abort the game if the player to move doesn't make their first
+// move in time, pushing them back in queues
+func (g *GameManager) WatchAbort(game *Game) {
+	moves := len(game.Moves())
+
+	if game.IsCorrespondence() || moves >= MAX_PLAYERS {
+		return
+	}
+
+	player := game.Current.Player
+
+	timeout := abortWindow(g.abortTimeout, game.Current.TimeLeft())
+
+	time.AfterFunc(timeout, func() {
+		if game.Abort(moves, ABORT_PENALTY) {
+			g.log().Info("Game aborted", "game_id", game.Id, "player_id", player.Id, "penalty", ABORT_PENALTY)
+		}
+	})
+}
+
+// The first move of a short game shouldn't take longer than the
+// game itself, left is the starting time on the clock
+func abortWindow(timeout, left time.Duration) time.Duration {
+	if left >= timeout {
+		return timeout
+	}
+
+	floor := minDuration(timeout, MIN_ABORT_TIMEOUT)
+	if left < floor {
+		return floor
+	}
+
+	return left
+}
+
+func (g *GameManager) CreateGame(players []*Player, timeControl TimeControl) (*Game, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	game, err := NewGame(players, timeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	game.WaitForOpening()
+
+	// correspondence players come and go, the game can't be
+	// resumed without tokens but it can still be played
+	if game.IsCorrespondence() {
+		if err := game.IssueTokens(); err != nil {
+			g.logger.Error("Issuing tokens failed", "game_id", game.Id, "error", err)
+		}
+	}
+
+	g.AddGame(game)
+
+	for _, player := range game.Players() {
+		player.Player.RecordColor(player.Color)
+	}
+
+	return game, nil
+}
+
+// Track game until it's over, expects the mutex to be held
+func (g *GameManager) AddGame(game *Game) {
+	game.chatLimit = g.chatLimit
 	g.games[game.Id] = game
 
+	logger := g.logger.With("game_id", game.Id)
+	audit := g.audit
+
 	go func() {
 		result := <-game.Over
 
+		// games ended by Suspend are waited for by Drain
+		if game.suspending {
+			defer g.notices.Done()
+		}
+
+		players := []*Player{}
+		for _, player := range game.Players() {
+			players = append(players, player.Player)
+		}
+		g.releaseBotGame(players)
+
 		g.RemoveGame(game.Id)
+		g.CancelForfeit(game.Id)
+
+		if result.Reason == "Suspended" {
+			logger.Info("Game suspended")
+
+			for _, player := range game.Players() {
+				player.Send(Response{
+					Type: GameSuspended,
+					Payload: SuspendedGame{
+						GameId: game.Id,
+						Token:  player.Token(),
+					},
+				})
+			}
+
+			game.CloseSpectators()
+
+			if err := audit.Result(game, result); err != nil {
+				logger.Error("Audit failed", "error", err)
+			}
+			return
+		}
+
+		if game.IsCorrespondence() {
+			g.deadlines.Cancel(game.Id)
+		} else if result.Winner != nil && result.Loser != nil {
+			g.OfferRematch(game)
+		}
+
+		// correspondence games and restored live games have a record
+		if game.IsCorrespondence() || game.restored {
+			g.mutex.Lock()
+			store := g.store
+			g.mutex.Unlock()
+
+			if store != nil {
+				if err := store.Delete(game.Id); err != nil {
+					logger.Error("Deleting game failed", "error", err)
+				}
+			}
+		}
+
+		logger.Info("Game over", "reason", result.Reason, "winner", playerId(result.Winner), "loser", playerId(result.Loser))
+		g.results.Inc(Labels{"reason": result.Reason})
+
+		if err := audit.Result(game, result); err != nil {
+			logger.Error("Audit failed", "error", err)
+		}
+
+		var winnerColor Color
+		for _, player := range game.Players() {
+			if player.Player == result.Winner {
+				winnerColor = player.Color
+			}
+		}
+
+		game.Broadcast(Response{
+			Type: GameOver,
+			Payload: GameOverResponse{
+				Reason:      result.Reason,
+				GameId:      game.Id,
+				WinnerColor: winnerColor,
+			},
+		})
+		game.CloseSpectators()
 
 		if result.Winner != nil {
-			result.Winner.Send(Response{
+			game.SendTo(result.Winner, Response{
 				Type: GameOver,
 				Payload: GameOverResponse{
 					Reason: result.Reason,
@@ -43,7 +501,7 @@ func (g *GameManager) CreateGame(players []*Player, timeControl TimeControl) *Ga
 		}
 
 		if result.Loser != nil {
-			result.Loser.Send(Response{
+			game.SendTo(result.Loser, Response{
 				Type: GameOver,
 				Payload: GameOverResponse{
 					Reason: result.Reason,
@@ -52,9 +510,107 @@ func (g *GameManager) CreateGame(players []*Player, timeControl TimeControl) *Ga
 				},
 			})
 		}
+
+		// nobody won, let both players know
+		if result.Winner == nil && result.Loser == nil {
+			for _, player := range game.Players() {
+				player.Send(Response{
+					Type: GameOver,
+					Payload: GameOverResponse{
+						Reason: result.Reason,
+						Winner: false,
+						GameId: game.Id,
+					},
+				})
+			}
+		}
 	}()
+}
+
+// Let players pick a UCI engine binary as their bot opponent
+func (g *GameManager) RegisterEngine(name string, command ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.engines[name] = command
+}
+
+// Searcher for a bot, the built-in engine unless an external one is named
+func (g *GameManager) NewSearcher(engine string, level BotLevel) (Searcher, error) {
+	if engine == "" {
+		return NewEngine(level.Depth, level.MoveTime), nil
+	}
+
+	g.mutex.Lock()
+	command, ok := g.engines[engine]
+	g.mutex.Unlock()
+
+	if !ok {
+		return nil, errors.New("Unknown engine")
+	}
+
+	return NewUCIEngine(level.MoveTime, command[0], command[1:]...)
+}
+
+// Keep finished game around so players can ask for a rematch,
+// the server's bots are done once their game is over
+func (g *GameManager) OfferRematch(game *Game) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	players := []*Player{}
+	for _, player := range game.Players() {
+		if player.Player.IsEngine() {
+			return
+		}
+		players = append(players, player.Player)
+	}
+
+	rematch := NewRematch(game.Id, players, game.Current.TimeControl)
+	g.rematches[game.Id] = rematch
+
+	time.AfterFunc(g.rematchTimeout, func() {
+		if g.RemoveRematch(game.Id) != nil {
+			for _, player := range rematch.Requested() {
+				player.Send(Response{
+					Type:    RematchCanceled,
+					Payload: game.Id,
+				})
+			}
+		}
+	})
+}
+
+func (g *GameManager) FindRematch(gameId uuid.UUID) *Rematch {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.rematches[gameId]
+}
+
+// Remove pending rematch, returns nil if there wasn't one
+func (g *GameManager) RemoveRematch(gameId uuid.UUID) *Rematch {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	rematch := g.rematches[gameId]
+	delete(g.rematches, gameId)
+
+	return rematch
+}
+
+func (g *GameManager) FindPlayerRematches(player *Player) []*Rematch {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	rematches := []*Rematch{}
+	for _, rematch := range g.rematches {
+		if rematch.HasPlayer(player) {
+			rematches = append(rematches, rematch)
+		}
+	}
 
-	return game
+	return rematches
 }
 
 func (g *GameManager) RemoveGame(gameId uuid.UUID) {
@@ -71,75 +627,692 @@ func (g *GameManager) FindGame(gameId uuid.UUID) *Game {
 	return g.games[gameId]
 }
 
-func (g *GameManager) FindPlayerGame(player *Player) *Game {
+// Each bot game may run an engine process, players get one at a
+// time, returns false when player already has one
+func (g *GameManager) reserveBot(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.botPlayers[player] {
+		return false
+	}
+
+	g.botPlayers[player] = true
+	return true
+}
+
+func (g *GameManager) releaseBot(player *Player) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	delete(g.botPlayers, player)
+}
+
+// Let the players of a game against a server bot play another
+func (g *GameManager) releaseBotGame(players []*Player) {
+	for _, player := range players {
+		if player.IsEngine() {
+			for _, p := range players {
+				g.releaseBot(p)
+			}
+			return
+		}
+	}
+}
+
+// Games player is seated at, correspondence players may have many
+func (g *GameManager) FindPlayerGames(player *Player) []*Game {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	games := []*Game{}
+
+	for _, game := range g.games {
+		if game.HasPlayer(player) {
+			games = append(games, game)
+		}
+	}
+
+	return games
+}
+
+func (g *GameManager) FindSpectatedGames(player *Player) []*Game {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	games := []*Game{}
+
 	for _, game := range g.games {
-		for p := game.Current; p != nil; p = p.Next {
-			if p.Player == player {
-				return game
+		if game.IsSpectator(player) {
+			games = append(games, game)
+		}
+	}
+
+	return games
+}
+
+// Ongoing games sorted by the average rating of the players
+// or by start time, most recent first
+func (g *GameManager) ListGames(sortBy string) []GameSummary {
+	g.mutex.Lock()
+	games := make([]*Game, 0, len(g.games))
+	for _, game := range g.games {
+		games = append(games, game)
+	}
+	g.mutex.Unlock()
+
+	summaries := make([]GameSummary, 0, len(games))
+	for _, game := range games {
+		summaries = append(summaries, game.Summary())
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if sortBy == SortByRating {
+			a := summaries[i].White.Rating + summaries[i].Black.Rating
+			b := summaries[j].White.Rating + summaries[j].Black.Rating
+
+			if a != b {
+				return a > b
 			}
 		}
+		return summaries[i].StartedAt.After(summaries[j].StartedAt)
+	})
+
+	return summaries
+}
+
+func (g *GameManager) Routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/games": g.ServeGames,
 	}
+}
+
+func (g *GameManager) ServeGames(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	json.NewEncoder(w).Encode(g.ListGames(r.URL.Query().Get("sort")))
+}
+
+// Let players know how many people are watching
+func (g *GameManager) NotifySpectators(game *Game) {
+	count := game.Spectators()
+
+	for _, player := range game.Players() {
+		player.Send(Response{
+			Type: SpectatorCount,
+			Payload: SpectatorsResponse{
+				GameId: game.Id,
+				Count:  count,
+			},
+		})
+	}
+}
+
+// Settle a game, e.g. one that got stuck, with winner winning
+// for reason, or without a result when there's no winner
+func (g *GameManager) EndGame(gameId uuid.UUID, winner Color, reason string) error {
+	if winner != "" && winner != White && winner != Black {
+		return errors.New("Unknown color")
+	}
+
+	game := g.FindGame(gameId)
+	if game == nil {
+		return errors.New("Game not found")
+	}
+
+	ended := game.Do(func() {
+		if winner == "" {
+			game.end(nil, "Aborted")
+			return
+		}
+
+		for _, player := range game.Players() {
+			if player.Color != winner {
+				game.end(player.Player, reason)
+			}
+		}
+	})
+
+	if !ended {
+		return errors.New("Game is over")
+	}
+
+	g.log().Info("Game ended by a moderator", "game_id", gameId, "winner", winner, "reason", reason)
 
 	return nil
 }
 
+// Pass the turn once a move is on the board, unless it ended the game
+func (g *GameManager) FinishTurn(game *Game, moves []MoveResponse) {
+	player := game.Current
+
+	// a move that came in after the flag doesn't count, even
+	// when it would have won
+	if game.EndTurn() {
+		game.end(player.Player, "Timeout")
+		return
+	}
+
+	// the second half of castling is the same move
+	played := moves[0]
+	played.GameId = game.Id
+	played.Time = player.TimeLeft().Milliseconds()
+
+	g.mutex.Lock()
+	audit := g.audit
+	g.mutex.Unlock()
+
+	if err := audit.Move(game, player, played); err != nil {
+		g.log().Error("Audit failed", "game_id", game.Id, "error", err)
+	}
+
+	for _, move := range moves {
+		move.GameId = game.Id
+		move.Time = game.Current.Next.TimeLeft().Milliseconds()
+
+		game.Broadcast(Response{
+			Type:    MoveMade,
+			Payload: move,
+		})
+	}
+
+	if game.VariantWin() {
+		return
+	}
+
+	if game.IsCheckmate() {
+		game.Checkmate()
+	} else {
+		// time on the clock as the turn starts
+		left := game.Current.TimeLeft()
+		game.StartTurn()
+		g.Save(game)
+		g.WatchAbort(game)
+
+		for _, move := range moves {
+			move.GameId = game.Id
+			move.Time = left.Milliseconds()
+
+			game.Current.Send(Response{
+				Type:    StartTurn,
+				Payload: move,
+			})
+		}
+	}
+}
+
+func (g *GameManager) Collect(metrics *MetricsWriter) {
+	g.mutex.Lock()
+	live := len(g.games)
+	g.mutex.Unlock()
+
+	metrics.Gauge("chess_live_games", "Games being played.", Sample{Value: float64(live)})
+	metrics.Counter("chess_moves_total", "Moves processed.", g.moves)
+	metrics.Histogram("chess_move_duration_seconds", "Time from receiving a move to having processed it.", g.moveLatency)
+	metrics.Counter("chess_game_results_total", "Finished games by reason.", g.results)
+}
+
+func (g *GameManager) Topics() []MessageType {
+	return []MessageType{
+		CreateGame,
+		PlayBot,
+		Move,
+		ResumeGame,
+		Resign,
+		ListGames,
+		Chat,
+		MuteChat,
+		UnmuteChat,
+		RequestRematch,
+		DeclineRematch,
+		WatchGame,
+		UnwatchGame,
+		Disconnected,
+	}
+}
+
+// Play the move on game, from the game's goroutine
+func (g *GameManager) PlayMove(game *Game, player *Player, data MovePiece) {
+	if game.Current.Player != player {
+		player.Send(Response{
+			Type: Error,
+			Text: "Not your turn",
+		})
+		return
+	}
+
+	if data.Drop != "" {
+		if err := game.Drop(data.Drop, data.To); err != nil {
+			g.log().Debug("Move rejected", "game_id", game.Id, "player_id", playerId(player), "error", err)
+			player.Send(Response{
+				Type: Error,
+				Text: err.Error(),
+			})
+			return
+		}
+
+		g.FinishTurn(game, []MoveResponse{{
+			Drop: strings.ToUpper(data.Drop),
+			To:   data.To,
+		}})
+		return
+	}
+
+	moves := game.Move(data.From, data.To)
+	if len(moves) > 0 {
+		responses := []MoveResponse{}
+
+		for _, move := range moves {
+			responses = append(responses, MoveResponse{
+				From: move.From.String(),
+				To:   move.To.String(),
+			})
+		}
+
+		g.FinishTurn(game, responses)
+	}
+}
+
+// Catch player up with a game they came back to
+func (g *GameManager) Resume(game *Game, player *GamePlayer) {
+	// suspended games go on once both players are back
+	if !game.IsCorrespondence() && game.IsAttended() {
+		g.CancelForfeit(game.Id)
+		game.ResumeClock()
+		g.WatchAbort(game)
+	}
+
+	player.Player.Send(Response{
+		Type:    GameState,
+		Payload: game.State(),
+	})
+
+	// replay the move that's waiting for an answer
+	if move, ok := game.LastMove(); ok && game.Current == player {
+		move.GameId = game.Id
+		move.Time = player.TimeLeft().Milliseconds()
+
+		player.Send(Response{
+			Type:    StartTurn,
+			Payload: move,
+		})
+	}
+}
+
 func (g *GameManager) Process(event Message) {
 	switch event.Type {
 	case CreateGame:
-		payload := event.Payload.(MatchParams)
-		game := g.CreateGame(payload.Players, payload.TimeControl)
-		game.Start()
+		payload, ok := event.Payload.(MatchParams)
+		if !ok {
+			g.log().Warn("Dropped message", "type", event.Type)
+			return
+		}
+
+		game, err := g.CreateGame(payload.Players, payload.TimeControl)
+		if err != nil {
+			g.releaseBotGame(payload.Players)
+			g.log().Warn("Creating game failed", "players", PlayerIds(payload.Players), "error", err)
+
+			for _, player := range payload.Players {
+				notify(player, Response{
+					Type: Error,
+					Text: "Invalid time control",
+				})
+			}
+			return
+		}
+
+		g.log().Info("Game started",
+			"game_id", game.Id,
+			"players", PlayerIds(payload.Players),
+			"time_control", payload.TimeControl,
+		)
+
+		game.Do(func() {
+			game.Start()
+			g.Save(game)
+			g.WatchAbort(game)
+		})
+	case PlayBot:
+		g.mutex.Lock()
+		draining := g.draining
+		g.mutex.Unlock()
+
+		if draining {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Server is shutting down",
+			})
+			return
+		}
+
+		var params PlayBotParams
+		mapstructure.Decode(event.Payload, &params)
+
+		if params.Level == 0 {
+			params.Level = 1
+		}
+		if params.TimeControl.Duration == "" {
+			params.TimeControl = BOT_TIME_CONTROL
+		}
+
+		if !IsVariant(params.TimeControl.Variant) {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Unknown variant",
+			})
+			return
+		}
+
+		if err := ValidateTimeControl(params.TimeControl); err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid time control",
+			})
+			return
+		}
+
+		level, err := GetBotLevel(params.Level)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: err.Error(),
+			})
+			return
+		}
+
+		if !g.reserveBot(event.Player) {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Already playing a bot",
+			})
+			return
+		}
+
+		searcher, err := g.NewSearcher(params.Engine, level)
+		if err != nil {
+			g.releaseBot(event.Player)
+			g.log().Warn("Starting engine failed", "engine", params.Engine, "error", err)
+			event.Player.Send(Response{
+				Type: Error,
+				Text: err.Error(),
+			})
+			return
+		}
+
+		if !searcher.Supports(params.TimeControl.Variant) {
+			searcher.Close()
+			g.releaseBot(event.Player)
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Variant not supported by engine",
+			})
+			return
+		}
+
+		bot := NewBot(g.bus, searcher, level.Rating)
+
+		g.bus.Publish(Message{
+			Type: CreateGame,
+			Payload: MatchParams{
+				Id: uuid.New(),
+				Players: g.colors.Assign(MatchParams{
+					Players: []*Player{event.Player, bot.Player},
+					Color:   params.Color,
+				}),
+				TimeControl: params.TimeControl,
+			},
+		})
 	case Move:
 		var data MovePiece
 		mapstructure.Decode(event.Payload, &data)
 
 		gameUuid, err := uuid.Parse(data.GameId)
 		if err != nil {
+			g.log().Debug("Dropped message", "type", event.Type, "player_id", playerId(event.Player), "error", err)
 			return
 		}
 
+		// only the players seated at the board may move
 		game := g.FindGame(gameUuid)
-		if game == nil {
+		if game == nil || !game.HasPlayer(event.Player) {
+			g.log().Debug("Dropped message", "type", event.Type, "player_id", playerId(event.Player), "game_id", gameUuid)
 			return
 		}
 
-		moves := game.Move(data.From, data.To)
-		if len(moves) > 0 {
-			game.EndTurn()
+		received := time.Now()
 
-			if game.IsCheckmate() {
-				game.Checkmate()
-			} else {
-				game.StartTurn()
-
-				for _, move := range moves {
-					game.Current.Send(Response{
-						Type: StartTurn,
-						Payload: MoveResponse{
-							From:   move.From.String(),
-							To:     move.To.String(),
-							Time:   game.Current.left.Milliseconds(),
-							GameId: gameUuid,
-						},
-					})
-				}
-			}
+		game.Do(func() {
+			g.PlayMove(game, event.Player, data)
+
+			g.moves.Inc(nil)
+			g.moveLatency.Since(received)
+		})
+	case ResumeGame:
+		var params ResumeParams
+		mapstructure.Decode(event.Payload, &params)
+
+		gameId, err := uuid.Parse(params.GameId)
+		if err != nil {
+			return
+		}
+
+		var player *GamePlayer
+		game := g.FindGame(gameId)
+
+		if game != nil {
+			player = game.Attach(event.Player, params.Token)
 		}
+
+		if player == nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Game not found",
+			})
+			return
+		}
+
+		game.Do(func() {
+			g.Resume(game, player)
+		})
 	case Resign:
-		gameId, err := uuid.Parse(event.Payload.(string))
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
 
-		if err == nil {
-			game := g.FindGame(gameId)
+		game := g.FindGame(gameId)
+
+		if game != nil && game.HasPlayer(event.Player) {
 			game.GameOver(event.Player, "Resignation")
 		}
-	case Disconnected:
-		game := g.FindPlayerGame(event.Player)
+	case ListGames:
+		var params ListGamesParams
+		mapstructure.Decode(event.Payload, &params)
+
+		event.Player.Send(Response{
+			Type:    GameList,
+			Payload: g.ListGames(params.Sort),
+		})
+	case Chat:
+		var data ChatMessage
+		mapstructure.Decode(event.Payload, &data)
+
+		gameId, err := uuid.Parse(data.GameId)
+		if err != nil {
+			return
+		}
+
+		game := g.FindGame(gameId)
+		if game == nil {
+			return
+		}
+
+		if data.Channel == "" {
+			data.Channel = PlayersChannel
+		}
+
+		if err := game.Chat(event.Player, data.Channel, data.Text); err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: err.Error(),
+			})
+			return
+		}
+
+		// correspondence chat is kept in the store with the moves
+		game.Do(func() {
+			g.Save(game)
+		})
+	case MuteChat, UnmuteChat:
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
 
+		game := g.FindGame(gameId)
 		if game != nil {
-			game.GameOver(event.Player, "Abandonment")
+			game.Mute(event.Player, event.Type == MuteChat)
+		}
+	case RequestRematch:
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
+
+		g.mutex.Lock()
+		draining := g.draining
+		g.mutex.Unlock()
+
+		if draining {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Server is shutting down",
+			})
+			return
+		}
+
+		rematch := g.FindRematch(gameId)
+		if rematch == nil || !rematch.HasPlayer(event.Player) {
+			return
+		}
+
+		if rematch.Request(event.Player) {
+			if g.RemoveRematch(gameId) != nil {
+				g.bus.Publish(Message{
+					Type: CreateGame,
+					Payload: MatchParams{
+						Id:          gameId,
+						Players:     rematch.Colors(),
+						TimeControl: rematch.TimeControl,
+					},
+				})
+			}
+		} else {
+			rematch.Opponent(event.Player).Send(Response{
+				Type:    RematchOffered,
+				Payload: gameId,
+			})
+		}
+	case DeclineRematch:
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
+
+		rematch := g.FindRematch(gameId)
+		if rematch != nil && rematch.HasPlayer(event.Player) && g.RemoveRematch(gameId) != nil {
+			rematch.Opponent(event.Player).Send(Response{
+				Type:    RematchCanceled,
+				Payload: gameId,
+			})
+		}
+	case WatchGame:
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
+
+		game := g.FindGame(gameId)
+		if game == nil || game.HasPlayer(event.Player) {
+			return
+		}
+
+		spectator := game.AddSpectator(event.Player)
+		spectator.Send(Response{
+			Type:    GameState,
+			Payload: game.State(),
+		})
+
+		g.NotifySpectators(game)
+	case UnwatchGame:
+		gameId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid game id",
+			})
+			return
+		}
+
+		game := g.FindGame(gameId)
+		if game != nil && game.RemoveSpectator(event.Player) {
+			g.NotifySpectators(game)
+		}
+	case Disconnected:
+		for _, rematch := range g.FindPlayerRematches(event.Player) {
+			if g.RemoveRematch(rematch.GameId) != nil {
+				rematch.Opponent(event.Player).Send(Response{
+					Type:    RematchCanceled,
+					Payload: rematch.GameId,
+				})
+			}
+		}
+
+		for _, game := range g.FindSpectatedGames(event.Player) {
+			if game.RemoveSpectator(event.Player) {
+				g.NotifySpectators(game)
+			}
+		}
+
+		for _, game := range g.FindPlayerGames(event.Player) {
+			if game.IsCorrespondence() {
+				game.Detach(event.Player)
+			} else {
+				game.GameOver(event.Player, "Abandonment")
+			}
 		}
 	}
 }
+
+// Parse an id sent as a plain string payload, anything
+// else is malformed input from the client
+func parseId(payload interface{}) (uuid.UUID, error) {
+	id, ok := payload.(string)
+	if !ok {
+		return uuid.Nil, errors.New("id must be a string")
+	}
+
+	return uuid.Parse(id)
+}
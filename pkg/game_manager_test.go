@@ -1,7 +1,12 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,7 +25,8 @@ func wait(cb func()) chan bool {
 }
 
 func TestIgnoresIrrelevantEvents(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	<-wait(func() {
 		gameManager.Process(Message{
@@ -34,7 +40,8 @@ func TestIgnoresIrrelevantEvents(t *testing.T) {
 }
 
 func TestCreatesGame(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -86,7 +93,8 @@ func TestCreatesGame(t *testing.T) {
 }
 
 func TestMovePieceHandler(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -109,7 +117,8 @@ func TestMovePieceHandler(t *testing.T) {
 	game := gameManager.FindGame(params.GameId)
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p1,
 		Payload: map[string]interface{}{
 			"from":    "e2",
 			"to":      "e4",
@@ -127,7 +136,8 @@ func TestMovePieceHandler(t *testing.T) {
 	}
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p2,
 		Payload: map[string]interface{}{
 			"from":    "e7",
 			"to":      "e5",
@@ -166,8 +176,140 @@ func TestMovePieceHandler(t *testing.T) {
 	}
 }
 
+func TestMoveAfterFlagLoses(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "1m"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	play := func(player, opponent *Player, from, to string) {
+		go manager.Process(Message{
+			Type:   Move,
+			Player: player,
+			Payload: map[string]interface{}{
+				"from":    from,
+				"to":      to,
+				"game_id": params.GameId.String(),
+			},
+		})
+		<-opponent.Outgoing
+	}
+
+	play(p1, p2, "f2", "f3")
+	play(p2, p1, "e7", "e5")
+	play(p1, p2, "g2", "g4")
+
+	// black's time ran out without the clock noticing yet
+	game := manager.FindGame(params.GameId)
+	game.Do(func() {
+		game.PauseClock()
+		game.Current.StopTimer()
+		game.clock.Set(Black, -time.Second)
+		game.StartTurn()
+	})
+
+	go manager.Process(Message{
+		Type:   Move,
+		Player: p2,
+		Payload: map[string]interface{}{
+			"from":    "d8",
+			"to":      "h4",
+			"game_id": params.GameId.String(),
+		},
+	})
+
+	for _, player := range []*Player{p1, p2} {
+		select {
+		case res := <-player.Outgoing:
+			if res.Type != GameOver {
+				t.Fatalf("Expected game over without the late move, got %v", res.Type)
+			}
+
+			result := res.Payload.(GameOverResponse)
+			if result.Reason != "Timeout" || result.Winner != (player == p1) {
+				t.Errorf("Expected white to win on time, got %+v", result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected game over, got timeout")
+		}
+	}
+}
+
+func TestRefusesMovesFromOthers(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	stranger := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "1m",
+				Increment: "0s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+	game := manager.FindGame(params.GameId)
+
+	move := map[string]interface{}{
+		"from":    "e2",
+		"to":      "e4",
+		"game_id": game.Id.String(),
+	}
+
+	manager.Process(Message{
+		Type:    Move,
+		Player:  stranger,
+		Payload: move,
+	})
+
+	if game.board.Square("e2") != Pawn(White) {
+		t.Errorf("Expected a move from a non-participant to be refused, got %v on e2", game.board.Square("e2"))
+	}
+
+	go manager.Process(Message{
+		Type:    Move,
+		Player:  p2,
+		Payload: move,
+	})
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("Expected an error, got timeout")
+	case response := <-p2.Outgoing:
+		if response.Type != Error || response.Text != "Not your turn" {
+			t.Errorf("Expected Not your turn, got %v", response)
+		}
+	}
+
+	if game.board.Square("e2") != Pawn(White) {
+		t.Errorf("Expected a move out of turn to be refused, got %v on e2", game.board.Square("e2"))
+	}
+
+}
+
 func TestSendsMoveEventToPlayer(t *testing.T) {
-	manager := NewGameManager()
+	bus := NewBus()
+	manager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -189,7 +331,8 @@ func TestSendsMoveEventToPlayer(t *testing.T) {
 	params := res.Payload.(GameStart)
 
 	go manager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p1,
 		Payload: map[string]interface{}{
 			"from":    "e2",
 			"to":      "e4",
@@ -221,7 +364,8 @@ func TestSendsMoveEventToPlayer(t *testing.T) {
 }
 
 func TestGameOver(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -240,6 +384,28 @@ func TestGameOver(t *testing.T) {
 	res := <-p1.Outgoing
 	<-p2.Outgoing
 
+	gameId := res.Payload.(GameStart).GameId.String()
+
+	// clocks run once both sides made their first move
+	for _, move := range []struct {
+		player, opponent *Player
+		from, to         string
+	}{
+		{p1, p2, "e2", "e4"},
+		{p2, p1, "e7", "e5"},
+	} {
+		go gameManager.Process(Message{
+			Type:   Move,
+			Player: move.player,
+			Payload: map[string]interface{}{
+				"from":    move.from,
+				"to":      move.to,
+				"game_id": gameId,
+			},
+		})
+		<-move.opponent.Outgoing
+	}
+
 	select {
 	case res := <-p1.Outgoing:
 		result := res.Payload.(GameOverResponse)
@@ -266,7 +432,8 @@ func TestGameOver(t *testing.T) {
 }
 
 func TestWhiteResign(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -314,7 +481,8 @@ func TestWhiteResign(t *testing.T) {
 }
 
 func TestBlackResign(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -362,7 +530,8 @@ func TestBlackResign(t *testing.T) {
 }
 
 func TestBlackDisconnectEndsGame(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -413,7 +582,8 @@ func TestBlackDisconnectEndsGame(t *testing.T) {
 }
 
 func TestWhiteDisconnectEndsGame(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -464,7 +634,8 @@ func TestWhiteDisconnectEndsGame(t *testing.T) {
 }
 
 func TestUnknownProblem(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -520,7 +691,8 @@ func TestUnknownProblem(t *testing.T) {
 	game.Current.Next.King = "g5"
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p1,
 		Payload: MovePiece{
 			To:     "g7",
 			From:   "e7",
@@ -535,7 +707,8 @@ func TestUnknownProblem(t *testing.T) {
 }
 
 func TestYetAnotherUnknownProblem(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -607,7 +780,8 @@ func TestYetAnotherUnknownProblem(t *testing.T) {
 	game.EndTurn()
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p2,
 		Payload: MovePiece{
 			To:     "c6",
 			From:   "d7",
@@ -622,7 +796,8 @@ func TestYetAnotherUnknownProblem(t *testing.T) {
 }
 
 func TestOneMoreUnknownProblem(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -699,7 +874,8 @@ func TestOneMoreUnknownProblem(t *testing.T) {
 	game.EndTurn()
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p2,
 		Payload: MovePiece{
 			To:     "a5",
 			From:   "a6",
@@ -715,7 +891,8 @@ func TestOneMoreUnknownProblem(t *testing.T) {
 }
 
 func TestNoMateButShouldBeMate(t *testing.T) {
-	gameManager := NewGameManager()
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -787,7 +964,8 @@ func TestNoMateButShouldBeMate(t *testing.T) {
 	}
 
 	go gameManager.Process(Message{
-		Type: Move,
+		Type:   Move,
+		Player: p1,
 		Payload: MovePiece{
 			To:     "h8",
 			From:   "h7",
@@ -814,3 +992,1092 @@ func TestNoMateButShouldBeMate(t *testing.T) {
 		t.Errorf("Expected black to lose by checkmate")
 	}
 }
+
+func TestSpectatorReceivesMoves(t *testing.T) {
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	spectator := NewTestPlayer()
+
+	go gameManager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "5m",
+				Increment: "0s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+
+	go gameManager.Process(Message{
+		Type:    WatchGame,
+		Player:  spectator,
+		Payload: params.GameId.String(),
+	})
+
+	state := <-spectator.Outgoing
+	if state.Type != GameState {
+		t.Errorf("Expected game state, got %v", state.Type)
+	}
+
+	payload := state.Payload.(GameStateResponse)
+	if payload.Fen != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1" {
+		t.Errorf("Expected initial position, got %v", payload.Fen)
+	}
+
+	for _, player := range []*Player{p1, p2} {
+		count := <-player.Outgoing
+		if count.Type != SpectatorCount {
+			t.Errorf("Expected spectator count, got %v", count.Type)
+		}
+		if count.Payload.(SpectatorsResponse).Count != 1 {
+			t.Errorf("Expected 1 spectator, got %v", count.Payload)
+		}
+	}
+
+	go gameManager.Process(Message{
+		Type:   Move,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": params.GameId.String(),
+		},
+	})
+
+	<-p2.Outgoing
+
+	select {
+	case res := <-spectator.Outgoing:
+		if res.Type != MoveMade {
+			t.Errorf("Expected move made, got %v", res.Type)
+		}
+		if res.Payload.(MoveResponse).To != "e4" {
+			t.Errorf("Expected move to e4, got %v", res.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected spectator to receive move, got timeout")
+	}
+
+	go gameManager.Process(Message{
+		Type:   Move,
+		Player: spectator,
+		Payload: map[string]interface{}{
+			"from":    "e7",
+			"to":      "e5",
+			"game_id": params.GameId.String(),
+		},
+	})
+
+	select {
+	case <-p1.Outgoing:
+		t.Error("Spectators should not be able to move")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	go gameManager.Process(Message{
+		Type:    Resign,
+		Player:  p2,
+		Payload: params.GameId.String(),
+	})
+
+	<-p1.Outgoing
+	<-p2.Outgoing
+
+	select {
+	case res := <-spectator.Outgoing:
+		result := res.Payload.(GameOverResponse)
+		if result.WinnerColor != White {
+			t.Errorf("Expected white to win, got %v", result.WinnerColor)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected spectator to receive game over, got timeout")
+	}
+}
+
+func TestSpectatorFallingBehindResyncs(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	watcher := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "5m"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	game := manager.FindGame(params.GameId)
+	game.AddSpectator(watcher)
+
+	for i := 0; i < SPECTATOR_BUFFER+10; i++ {
+		game.Broadcast(Response{Type: SpectatorCount})
+	}
+
+	if res := <-watcher.Outgoing; res.Type != SpectatorCount {
+		t.Fatalf("Expected the first response, got %v", res.Type)
+	}
+
+	select {
+	case res := <-watcher.Outgoing:
+		if res.Type != GameState {
+			t.Errorf("Expected a resync after dropped responses, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a resync, got timeout")
+	}
+}
+
+func TestSpectatorClosingMidGame(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	watcher := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "5m"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	game := manager.FindGame(params.GameId)
+	game.AddSpectator(watcher)
+
+	// the socket drops before the bus tells the game
+	watcher.Close()
+
+	for i := 0; i < 3; i++ {
+		game.Broadcast(Response{Type: SpectatorCount})
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	game.mutex.Lock()
+	spectator := game.spectators[watcher]
+	game.mutex.Unlock()
+
+	spectator.mutex.Lock()
+	closed := spectator.closed
+	spectator.mutex.Unlock()
+
+	if !closed {
+		t.Error("Expected the spectator to close with its player")
+	}
+}
+
+func TestMalformedSpectatorPayload(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	for _, kind := range []MessageType{WatchGame, UnwatchGame} {
+		expectError(t, manager, Message{
+			Type:    kind,
+			Player:  NewTestPlayer(),
+			Payload: map[string]interface{}{"game_id": 42},
+		}, "Invalid game id")
+	}
+}
+
+// Process a malformed event and expect the sender to get an error back
+// instead of the handler panicking
+func expectError(t *testing.T, handler Handler, event Message, text string) {
+	t.Helper()
+
+	go handler.Process(event)
+
+	select {
+	case <-time.After(time.Second):
+		t.Errorf("Expected an error for %v, got timeout", event.Type)
+	case response := <-event.Player.Outgoing:
+		if response.Type != Error || response.Text != text {
+			t.Errorf("Expected error %q for %v, got %v", text, event.Type, response)
+		}
+	}
+}
+
+func TestListGames(t *testing.T) {
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	p3 := NewTestPlayer()
+	p4 := NewTestPlayer()
+
+	p3.Rating = 2000
+	p4.Rating = 2100
+
+	for _, players := range [][]*Player{{p1, p2}, {p3, p4}} {
+		go gameManager.Process(Message{
+			Type: CreateGame,
+			Payload: MatchParams{
+				Players: players,
+				TimeControl: TimeControl{
+					Duration:  "5m",
+					Increment: "3s",
+				},
+			},
+		})
+
+		<-players[0].Outgoing
+		<-players[1].Outgoing
+	}
+
+	byStart := gameManager.ListGames(SortByStart)
+	if len(byStart) != 2 {
+		t.Fatalf("Expected 2 games, got %v", len(byStart))
+	}
+	if byStart[0].White.Id != p3.Id {
+		t.Errorf("Expected most recent game first, got %+v", byStart[0])
+	}
+
+	go gameManager.Process(Message{
+		Type:    ListGames,
+		Player:  p1,
+		Payload: map[string]interface{}{"sort": "rating"},
+	})
+
+	res := <-p1.Outgoing
+	if res.Type != GameList {
+		t.Errorf("Expected game list, got %v", res.Type)
+	}
+
+	byRating := res.Payload.([]GameSummary)
+	if byRating[0].Black.Rating != 2100 {
+		t.Errorf("Expected highest rated game first, got %+v", byRating[0])
+	}
+	if byRating[1].TimeControl.Increment != "3s" {
+		t.Errorf("Expected 3s increment, got %v", byRating[1].TimeControl.Increment)
+	}
+	if byRating[1].Turn != White {
+		t.Errorf("Expected white to move, got %v", byRating[1].Turn)
+	}
+
+	recorder := httptest.NewRecorder()
+	gameManager.ServeGames(recorder, httptest.NewRequest("GET", "/games?sort=rating", nil))
+
+	var games []GameSummary
+	json.NewDecoder(recorder.Body).Decode(&games)
+
+	if len(games) != 2 || games[0].White.Rating != 2000 {
+		t.Errorf("Expected games sorted by rating, got %+v", games)
+	}
+}
+
+func TestChat(t *testing.T) {
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go gameManager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "5m",
+				Increment: "0s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+
+	go gameManager.Process(Message{
+		Type:   Chat,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"game_id": params.GameId.String(),
+			"text":    "good luck",
+		},
+	})
+
+	for _, player := range []*Player{p1, p2} {
+		select {
+		case res := <-player.Outgoing:
+			line := res.Payload.(ChatLine)
+			if line.Text != "good luck" {
+				t.Errorf("Expected good luck, got %v", line.Text)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected chat message, got timeout")
+		}
+	}
+
+	go gameManager.Process(Message{
+		Type:   Chat,
+		Player: p2,
+		Payload: map[string]interface{}{
+			"game_id": params.GameId.String(),
+			"text":    strings.Repeat("a", MAX_CHAT_LENGTH+1),
+		},
+	})
+
+	if res := <-p2.Outgoing; res.Type != Error {
+		t.Errorf("Expected error for long message, got %v", res.Type)
+	}
+
+	<-wait(func() {
+		gameManager.Process(Message{
+			Type:    MuteChat,
+			Player:  p1,
+			Payload: params.GameId.String(),
+		})
+	})
+
+	go gameManager.Process(Message{
+		Type:   Chat,
+		Player: p2,
+		Payload: map[string]interface{}{
+			"game_id": params.GameId.String(),
+			"text":    "you too",
+		},
+	})
+
+	<-p2.Outgoing
+
+	select {
+	case <-p1.Outgoing:
+		t.Error("Muted player should not receive chat")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	game := gameManager.FindGame(params.GameId)
+	if len(game.ChatHistory()) != 2 {
+		t.Errorf("Expected 2 messages in history, got %v", len(game.ChatHistory()))
+	}
+}
+
+func TestMalformedMutePayload(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	for _, kind := range []MessageType{MuteChat, UnmuteChat} {
+		expectError(t, manager, Message{
+			Type:    kind,
+			Player:  NewTestPlayer(),
+			Payload: []interface{}{"not", "an", "id"},
+		}, "Invalid game id")
+	}
+}
+
+func TestRematch(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	gameManager := NewGameManager(bus)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go gameManager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "3m",
+				Increment: "2s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+
+	go gameManager.Process(Message{
+		Type:    Resign,
+		Player:  p2,
+		Payload: params.GameId.String(),
+	})
+
+	<-p1.Outgoing
+	<-p2.Outgoing
+
+	go gameManager.Process(Message{
+		Type:    RequestRematch,
+		Player:  p1,
+		Payload: params.GameId.String(),
+	})
+
+	select {
+	case res := <-p2.Outgoing:
+		if res.Type != RematchOffered {
+			t.Errorf("Expected rematch offered, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected rematch offer, got timeout")
+	}
+
+	go gameManager.Process(Message{
+		Type:    RequestRematch,
+		Player:  p2,
+		Payload: params.GameId.String(),
+	})
+
+	select {
+	case res := <-events:
+		if res.Type != CreateGame {
+			t.Errorf("Expected create game, got %v", res.Type)
+		}
+
+		rematch := res.Payload.(MatchParams)
+		if rematch.Players[0] != p2 || rematch.Players[1] != p1 {
+			t.Error("Expected colors to be swapped")
+		}
+		if rematch.TimeControl.Duration != "3m" || rematch.TimeControl.Increment != "2s" {
+			t.Errorf("Expected same time control, got %+v", rematch.TimeControl)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected rematch to be created, got timeout")
+	}
+
+	if gameManager.FindRematch(params.GameId) != nil {
+		t.Error("Expected rematch to be removed")
+	}
+}
+
+func TestRematchExpires(t *testing.T) {
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
+	gameManager.rematchTimeout = 100 * time.Millisecond
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go gameManager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "3m",
+				Increment: "2s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+
+	go gameManager.Process(Message{
+		Type:    Resign,
+		Player:  p1,
+		Payload: params.GameId.String(),
+	})
+
+	<-p2.Outgoing
+	<-p1.Outgoing
+
+	go gameManager.Process(Message{
+		Type:    RequestRematch,
+		Player:  p1,
+		Payload: params.GameId.String(),
+	})
+
+	<-p2.Outgoing
+
+	select {
+	case res := <-p1.Outgoing:
+		if res.Type != RematchCanceled {
+			t.Errorf("Expected rematch canceled, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected rematch to expire, got timeout")
+	}
+}
+
+func TestMalformedRematchPayload(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	for _, kind := range []MessageType{RequestRematch, DeclineRematch} {
+		expectError(t, manager, Message{
+			Type:    kind,
+			Player:  NewTestPlayer(),
+			Payload: nil,
+		}, "Invalid game id")
+	}
+}
+
+func TestCorrespondenceResume(t *testing.T) {
+	bus := NewBus()
+	manager := NewGameManager(bus)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Days: 3},
+		},
+	})
+
+	white := (<-p1.Outgoing).Payload.(GameStart)
+	black := (<-p2.Outgoing).Payload.(GameStart)
+
+	if black.Token == "" || black.Token == white.Token {
+		t.Fatal("Expected each player to get a token")
+	}
+
+	<-wait(func() {
+		manager.Process(Message{Type: Disconnected, Player: p2})
+	})
+
+	if manager.FindGame(white.GameId) == nil {
+		t.Fatal("Expected game to wait for black")
+	}
+
+	<-wait(func() {
+		manager.Process(Message{
+			Type:   Move,
+			Player: p1,
+			Payload: map[string]interface{}{
+				"from":    "e2",
+				"to":      "e4",
+				"game_id": white.GameId.String(),
+			},
+		})
+	})
+
+	p3 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   ResumeGame,
+		Player: p3,
+		Payload: map[string]interface{}{
+			"game_id": black.GameId.String(),
+			"token":   "guessed",
+		},
+	})
+
+	if res := <-p3.Outgoing; res.Type != Error {
+		t.Errorf("Expected unknown token to be rejected, got %v", res.Type)
+	}
+
+	go manager.Process(Message{
+		Type:   ResumeGame,
+		Player: p3,
+		Payload: map[string]interface{}{
+			"game_id": black.GameId.String(),
+			"token":   black.Token,
+		},
+	})
+
+	state := (<-p3.Outgoing).Payload.(GameStateResponse)
+	if !reflect.DeepEqual(state.Moves, []string{"e2e4"}) {
+		t.Errorf("Expected e2e4, got %v", state.Moves)
+	}
+
+	select {
+	case res := <-p3.Outgoing:
+		move := res.Payload.(MoveResponse)
+		if res.Type != StartTurn || move.From != "e2" || move.To != "e4" {
+			t.Errorf("Expected to be asked to answer e2e4, got %v", res)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected start turn, got timeout")
+	}
+}
+
+func TestCorrespondenceRestore(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+
+	bus := NewBus()
+	manager := NewGameManager(bus)
+	manager.SetStore(store)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Days: 1},
+		},
+	})
+
+	white := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	go manager.Process(Message{
+		Type:   Move,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": white.GameId.String(),
+		},
+	})
+	<-p2.Outgoing
+
+	chatted := wait(func() {
+		manager.Process(Message{
+			Type:   Chat,
+			Player: p1,
+			Payload: map[string]interface{}{
+				"game_id": white.GameId.String(),
+				"text":    "good luck",
+			},
+		})
+	})
+	<-p2.Outgoing
+	<-p1.Outgoing
+	<-chatted
+
+	restarted := NewGameManager(bus)
+	restarted.SetStore(store)
+
+	if err := restarted.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	game := restarted.FindGame(white.GameId)
+	if game == nil {
+		t.Fatal("Expected game to be restored")
+	}
+
+	if game.Current.Color != Black || !reflect.DeepEqual(game.Moves(), []string{"e2e4"}) {
+		t.Errorf("Expected black to answer e2e4, got %v to move after %v", game.Current.Color, game.Moves())
+	}
+
+	if left := game.Current.TimeLeft(); left < 23*time.Hour {
+		t.Errorf("Expected about a day left, got %v", left)
+	}
+
+	if chat := game.ChatHistory(); len(chat) != 1 || chat[0].Text != "good luck" {
+		t.Errorf("Expected chat to survive the restart, got %v", chat)
+	}
+}
+
+func TestAbortsWithoutFirstMove(t *testing.T) {
+	bus := NewBus()
+	manager := NewGameManager(bus)
+	manager.abortTimeout = 50 * time.Millisecond
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "5m"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	go manager.Process(Message{
+		Type:   Move,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": params.GameId.String(),
+		},
+	})
+	<-p2.Outgoing
+
+	for _, player := range []*Player{p1, p2} {
+		select {
+		case res := <-player.Outgoing:
+			result := res.Payload.(GameOverResponse)
+			if res.Type != GameOver || result.Reason != "Aborted" || result.Winner {
+				t.Errorf("Expected game to be aborted without a winner, got %+v", res)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected game over, got timeout")
+		}
+	}
+
+	if manager.FindGame(params.GameId) != nil {
+		t.Error("Expected game to be removed")
+	}
+
+	if p1.PenalizedUntil().After(time.Now()) {
+		t.Error("Expected white not to be penalized for moving")
+	}
+	if !p2.PenalizedUntil().After(time.Now()) {
+		t.Error("Expected black to be penalized for not moving")
+	}
+}
+
+func TestClockWaitsForOpening(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "100ms"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	go manager.Process(Message{
+		Type:   Move,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": params.GameId.String(),
+		},
+	})
+	<-p2.Outgoing
+
+	time.Sleep(150 * time.Millisecond)
+
+	game := manager.FindGame(params.GameId)
+	if game == nil || game.IsOver() {
+		t.Fatal("Expected the game to wait for black's first move")
+	}
+
+	if left := game.Current.TimeLeft(); left != 100*time.Millisecond {
+		t.Errorf("Expected black's clock to wait, got %v left", left)
+	}
+	if left := game.Current.Next.TimeLeft(); left != 100*time.Millisecond {
+		t.Errorf("Expected white's first move to be free, got %v left", left)
+	}
+}
+
+func TestAbortWindow(t *testing.T) {
+	for _, test := range []struct {
+		timeout, left, expected time.Duration
+	}{
+		{30 * time.Second, 5 * time.Minute, 30 * time.Second},
+		{30 * time.Second, 15 * time.Second, 15 * time.Second},
+		{30 * time.Second, time.Second, MIN_ABORT_TIMEOUT},
+		{time.Second, 100 * time.Millisecond, time.Second},
+	} {
+		if window := abortWindow(test.timeout, test.left); window != test.expected {
+			t.Errorf("Expected %v to move with %v on the clock, got %v", test.expected, test.left, window)
+		}
+	}
+}
+
+func TestDrainSuspendsLiveGames(t *testing.T) {
+	store, _ := NewFileStore(t.TempDir())
+
+	bus := NewBus()
+	manager := NewGameManager(bus)
+	manager.SetStore(store)
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players:     []*Player{p1, p2},
+			TimeControl: TimeControl{Duration: "5m"},
+		},
+	})
+
+	params := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	// clocks run once both sides made their first move
+	for _, move := range []struct {
+		player, opponent *Player
+		from, to         string
+	}{
+		{p1, p2, "e2", "e4"},
+		{p2, p1, "e7", "e5"},
+	} {
+		go manager.Process(Message{
+			Type:   Move,
+			Player: move.player,
+			Payload: map[string]interface{}{
+				"from":    move.from,
+				"to":      move.to,
+				"game_id": params.GameId.String(),
+			},
+		})
+		<-move.opponent.Outgoing
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- manager.Drain(ctx)
+	}()
+
+	tokens := map[*Player]string{}
+	for _, player := range []*Player{p1, p2} {
+		select {
+		case <-drained:
+			t.Fatal("Expected drain to wait for resume tokens to be sent")
+		default:
+		}
+
+		select {
+		case res := <-player.Outgoing:
+			if res.Type != GameSuspended {
+				t.Fatalf("Expected game suspended, got %v", res.Type)
+			}
+			tokens[player] = res.Payload.(SuspendedGame).Token
+		case <-time.After(time.Second):
+			t.Fatal("Expected game suspended, got timeout")
+		}
+	}
+
+	restarted := NewGameManager(bus)
+	restarted.SetStore(store)
+
+	if err := restarted.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	game := restarted.FindGame(params.GameId)
+	if game == nil {
+		t.Fatal("Expected suspended game to be restored")
+	}
+
+	left := game.Current.TimeLeft()
+	time.Sleep(20 * time.Millisecond)
+
+	if game.Current.TimeLeft() != left {
+		t.Error("Expected clock to wait for the players")
+	}
+
+	p3 := NewTestPlayer()
+	p4 := NewTestPlayer()
+
+	for player, resumed := range map[*Player]*Player{p1: p3, p2: p4} {
+		go restarted.Process(Message{
+			Type:   ResumeGame,
+			Player: resumed,
+			Payload: map[string]interface{}{
+				"game_id": params.GameId.String(),
+				"token":   tokens[player],
+			},
+		})
+
+		if res := <-resumed.Outgoing; res.Type != GameState {
+			t.Fatalf("Expected game state, got %v", res.Type)
+		}
+
+		// white is to answer e7e5
+		if resumed == p3 {
+			<-resumed.Outgoing
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if game.Current.TimeLeft() >= left {
+		t.Error("Expected clock to run once both players are back")
+	}
+
+	restarted.mutex.Lock()
+	pending := len(restarted.forfeits)
+	restarted.mutex.Unlock()
+
+	if pending != 0 {
+		t.Error("Expected forfeit to be canceled once both players are back")
+	}
+
+	go restarted.Process(Message{
+		Type:    Resign,
+		Player:  p3,
+		Payload: params.GameId.String(),
+	})
+
+	for _, player := range []*Player{p4, p3} {
+		if res := <-player.Outgoing; res.Type != GameOver {
+			t.Fatalf("Expected game over, got %v", res.Type)
+		}
+	}
+
+	if records, _ := store.Load(); len(records) != 0 {
+		t.Errorf("Expected finished game to leave the store, got %v records", len(records))
+	}
+}
+
+func TestDrainRefusesBotGames(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, manager, Message{
+		Type:    PlayBot,
+		Player:  NewTestPlayer(),
+		Payload: map[string]interface{}{},
+	}, "Server is shutting down")
+}
+
+func TestAuditsSuspensions(t *testing.T) {
+	for reason, stored := range map[string]bool{"Suspended": true, "Aborted": false} {
+		out := new(bytes.Buffer)
+
+		manager := NewGameManager(NewBus())
+		manager.SetAudit(NewAuditLog(out))
+		if stored {
+			store, _ := NewFileStore(t.TempDir())
+			manager.SetStore(store)
+		}
+
+		p1 := NewTestPlayer()
+		p2 := NewTestPlayer()
+
+		go manager.Process(Message{
+			Type: CreateGame,
+			Payload: MatchParams{
+				Players:     []*Player{p1, p2},
+				TimeControl: TimeControl{Duration: "5m"},
+			},
+		})
+
+		<-p1.Outgoing
+		<-p2.Outgoing
+
+		// whatever the players are told, Drain waits for the audit log
+		done := make(chan bool)
+		for _, player := range []*Player{p1, p2} {
+			go func(player *Player) {
+				for {
+					select {
+					case <-player.Outgoing:
+					case <-done:
+						return
+					}
+				}
+			}(player)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		manager.Drain(ctx)
+		close(done)
+
+		var result AuditRecord
+		json.Unmarshal([]byte(strings.TrimSpace(out.String())), &result)
+
+		if result.Event != "result" || result.Reason != reason || result.Winner != nil {
+			t.Errorf("Expected %v game to be audited, got %v", reason, out.String())
+		}
+	}
+}
+
+func TestDrainRefusesRematches(t *testing.T) {
+	manager := NewGameManager(NewBus())
+
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, manager, Message{
+		Type:    RequestRematch,
+		Player:  NewTestPlayer(),
+		Payload: uuid.New().String(),
+	}, "Server is shutting down")
+}
+
+func TestAuditsMovesAndResults(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	bus := NewBus()
+	gameManager := NewGameManager(bus)
+	gameManager.SetAudit(NewAuditLog(out))
+
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	go gameManager.Process(Message{
+		Type: CreateGame,
+		Payload: MatchParams{
+			Players: []*Player{p1, p2},
+			TimeControl: TimeControl{
+				Duration:  "5s",
+				Increment: "0s",
+			},
+		},
+	})
+
+	res := <-p1.Outgoing
+	<-p2.Outgoing
+
+	params := res.Payload.(GameStart)
+
+	go gameManager.Process(Message{
+		Type:   Move,
+		Player: p1,
+		Payload: map[string]interface{}{
+			"from":    "e2",
+			"to":      "e4",
+			"game_id": params.GameId.String(),
+		},
+	})
+	<-p2.Outgoing
+
+	go gameManager.Process(Message{
+		Player:  p2,
+		Type:    Resign,
+		Payload: params.GameId.String(),
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-p1.Outgoing:
+		case <-p2.Outgoing:
+		case <-time.After(time.Second):
+			t.Fatal("Expected game over, got timeout instead")
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a move and a result, got %v", lines)
+	}
+
+	var move, result AuditRecord
+	json.Unmarshal([]byte(lines[0]), &move)
+	json.Unmarshal([]byte(lines[1]), &result)
+
+	if move.Event != "move" || move.Move != "e2e4" || *move.PlayerId != p1.Id || move.Color != White {
+		t.Errorf("Expected white's e2e4, got %+v", move)
+	}
+
+	if result.Event != "result" || result.Reason != "Resignation" || *result.Winner != p1.Id || *result.Loser != p2.Id {
+		t.Errorf("Expected black's resignation, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.Moves, []string{"e2e4"}) {
+		t.Errorf("Expected the moves of the game, got %v", result.Moves)
+	}
+}
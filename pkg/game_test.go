@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +13,7 @@ func TestAssignsColorsToPlayers(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "5m",
 		Increment: "0s",
 	})
@@ -41,7 +42,7 @@ func TestPausesTimerOnEndTurn(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "1s",
 		Increment: "0s",
 	})
@@ -63,7 +64,7 @@ func TestStartsWhiteTimer(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "500ms",
 		Increment: "0s",
 	})
@@ -85,11 +86,24 @@ func TestStartsWhiteTimer(t *testing.T) {
 	}
 }
 
+func TestNewGameRefusesInvalidTimeControls(t *testing.T) {
+	players := []*Player{NewTestPlayer(), NewTestPlayer()}
+
+	for _, timeControl := range []TimeControl{
+		{Duration: "forever"},
+		{Duration: "5m", Variant: "checkers"},
+	} {
+		if game, err := NewGame(players, timeControl); err == nil || game != nil {
+			t.Errorf("Expected %+v to be refused", timeControl)
+		}
+	}
+}
+
 func TestTimerStops(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "500ms",
 		Increment: "0s",
 	})
@@ -101,8 +115,8 @@ func TestTimerStops(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 	game.EndTurn()
 
-	if game.Current.Next.left < 200*time.Millisecond {
-		t.Errorf("Time left should be 250ms, got %v", game.Current.Next.left)
+	if game.Current.Next.TimeLeft() < 200*time.Millisecond {
+		t.Errorf("Time left should be 250ms, got %v", game.Current.Next.TimeLeft())
 	}
 }
 
@@ -110,7 +124,7 @@ func TestTimerContinues(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "500ms",
 		Increment: "0s",
 	})
@@ -137,7 +151,7 @@ func TestWhiteMovePassesTurn(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "100ms",
 		Increment: "0s",
 	})
@@ -164,7 +178,7 @@ func TestBlackMovePassesTurn(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "100ms",
 		Increment: "0s",
 	})
@@ -195,7 +209,7 @@ func TestWhiteCannotMoveBlackPiece(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "100ms",
 		Increment: "0s",
 	})
@@ -222,7 +236,7 @@ func TestBlackCannotMoveWhitePiece(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "100ms",
 		Increment: "0s",
 	})
@@ -254,7 +268,7 @@ func TestCheckmate(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "500ms",
 		Increment: "0s",
 	})
@@ -298,7 +312,7 @@ func TestBlockCheckmate(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "1s",
 		Increment: "0s",
 	})
@@ -351,7 +365,7 @@ func TestIncrements(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "1s",
 		Increment: "1s",
 	})
@@ -363,7 +377,7 @@ func TestIncrements(t *testing.T) {
 
 	game.EndTurn()
 
-	time := game.Current.Next.left
+	time := game.Current.Next.TimeLeft()
 	if time.Seconds() < 1.9 {
 		t.Errorf("Expected 2s, got %v", time)
 	}
@@ -373,7 +387,7 @@ func TestCastle(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	game := NewGame([]*Player{p1, p2}, TimeControl{
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
 		Duration:  "1s",
 		Increment: "1s",
 	})
@@ -397,3 +411,168 @@ func TestCastle(t *testing.T) {
 		t.Errorf("Expected rook on f1, got %v", game.board.Square("f1"))
 	}
 }
+
+func TestChatRateLimit(t *testing.T) {
+	game, _ := NewGame([]*Player{NewTestPlayer(), NewTestPlayer()}, TimeControl{
+		Duration:  "5m",
+		Increment: "0s",
+	})
+
+	spectator := NewTestPlayer()
+	game.AddSpectator(spectator)
+
+	for i := 0; i < CHAT_BURST; i++ {
+		if err := game.Chat(spectator, SpectatorsChannel, "hello"); err != nil {
+			t.Errorf("Expected message to be relayed, got %v", err)
+		}
+	}
+
+	if err := game.Chat(spectator, SpectatorsChannel, "hello"); err == nil {
+		t.Error("Expected rate limit error")
+	}
+	if err := game.Chat(spectator, PlayersChannel, "hello"); err == nil {
+		t.Error("Spectators should not chat with players")
+	}
+}
+
+func TestChess960Game(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{
+		Duration:  "1m",
+		Increment: "0s",
+		Variant:   Chess960,
+	})
+
+	go game.Start()
+
+	start := (<-p1.Outgoing).Payload.(GameStart)
+	<-p2.Outgoing
+
+	rank := strings.Split(start.Fen, "/")[7]
+	rank = strings.Split(rank, " ")[0]
+
+	if game.Current.King != string(rune('a'+strings.Index(rank, "K")))+"1" {
+		t.Errorf("Expected king on %v file, got %v", rank, game.Current.King)
+	}
+	if game.Current.Next.King[1] != '8' {
+		t.Errorf("Expected black king on the eighth rank, got %v", game.Current.Next.King)
+	}
+}
+
+func TestLagCompensation(t *testing.T) {
+	player := NewTestPlayer()
+	player.RecordLatency(100 * time.Millisecond)
+
+	timeControl := TimeControl{
+		Duration:  "1s",
+		Increment: "0s",
+	}
+	clock, _ := NewClock(timeControl)
+	defer clock.Close()
+
+	gamePlayer := NewGamePlayer(White, player, timeControl, "e1", clock)
+
+	gamePlayer.StartTimer()
+	time.Sleep(200 * time.Millisecond)
+	gamePlayer.StopTimer()
+
+	if left := gamePlayer.TimeLeft(); left < 850*time.Millisecond || left > 910*time.Millisecond {
+		t.Errorf("Expected lag to be credited, got %v", left)
+	}
+	if gamePlayer.Compensated() != 100*time.Millisecond {
+		t.Errorf("Expected 100ms compensated, got %v", gamePlayer.Compensated())
+	}
+}
+
+func TestLagCompensationIsBounded(t *testing.T) {
+	player := NewTestPlayer()
+	player.RecordLatency(5 * time.Second)
+
+	timeControl := TimeControl{
+		Duration:  "1s",
+		Increment: "0s",
+	}
+	clock, _ := NewClock(timeControl)
+	defer clock.Close()
+
+	gamePlayer := NewGamePlayer(White, player, timeControl, "e1", clock)
+
+	gamePlayer.StartTimer()
+	time.Sleep(100 * time.Millisecond)
+	gamePlayer.StopTimer()
+
+	if gamePlayer.Compensated() > 100*time.Millisecond+10*time.Millisecond {
+		t.Errorf("Expected no more than the time spent, got %v", gamePlayer.Compensated())
+	}
+
+	player.RecordLatency(5 * time.Second)
+
+	gamePlayer.StartTimer()
+	time.Sleep(MAX_LAG_COMPENSATION + 100*time.Millisecond)
+	gamePlayer.StopTimer()
+
+	if gamePlayer.Compensated() > 100*time.Millisecond+10*time.Millisecond+MAX_LAG_COMPENSATION {
+		t.Errorf("Expected compensation to be capped, got %v", gamePlayer.Compensated())
+	}
+}
+
+func TestGameEndsOnce(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{Duration: "5m"})
+
+	for _, reason := range []string{"Resignation", "Abandonment", "Timeout"} {
+		go game.GameOver(p1, reason)
+	}
+
+	select {
+	case result := <-game.Over:
+		if result.Winner != p2 {
+			t.Error("Expected black to win")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected game over, got timeout")
+	}
+
+	select {
+	case result := <-game.Over:
+		t.Errorf("Expected a single result, got %v", result.Reason)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if game.Do(func() {}) {
+		t.Error("Expected finished game not to take commands")
+	}
+}
+
+func TestMovesAreSerialized(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+
+	game, _ := NewGame([]*Player{p1, p2}, TimeControl{Duration: "5m"})
+	played := make(chan bool, 2)
+
+	for i := 0; i < 2; i++ {
+		go game.Do(func() {
+			if len(game.Move("e2", "e4")) > 0 {
+				game.EndTurn()
+				played <- true
+			}
+		})
+	}
+
+	<-played
+
+	select {
+	case <-played:
+		t.Error("Expected the second move to find the pawn gone")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if moves := game.Moves(); !reflect.DeepEqual(moves, []string{"e2e4"}) {
+		t.Errorf("Expected a single e2e4, got %v", moves)
+	}
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var logLevels = map[string]int{
+	LogDebug: 0,
+	LogInfo:  1,
+	LogWarn:  2,
+	LogError: 3,
+}
+
+// Logger writes records as JSON lines with a time, level, message
+// and key-value fields, e.g.
+//
+//	logger.Info("Game over", "game_id", game.Id, "reason", "Timeout")
+//
+// A nil logger discards everything, so it's fine to leave unset
+type Logger struct {
+	out    io.Writer
+	level  int
+	fields []interface{}
+	mutex  *sync.Mutex
+}
+
+// Records below level are dropped, see LogDebug and friends
+func NewLogger(out io.Writer, level string) *Logger {
+	return &Logger{
+		out:   out,
+		level: logLevels[level],
+		mutex: new(sync.Mutex),
+	}
+}
+
+// Logger adding args to every record, sharing l's output
+func (l *Logger) With(args ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(args))
+	fields = append(fields, l.fields...)
+	fields = append(fields, args...)
+
+	return &Logger{
+		out:    l.out,
+		level:  l.level,
+		fields: fields,
+		mutex:  l.mutex,
+	}
+}
+
+func (l *Logger) Enabled(level string) bool {
+	return l != nil && logLevels[level] >= l.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(LogDebug, msg, args)
+}
+
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(LogInfo, msg, args)
+}
+
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.log(LogWarn, msg, args)
+}
+
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.log(LogError, msg, args)
+}
+
+func (l *Logger) log(level, msg string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	record := new(bytes.Buffer)
+	record.WriteByte('{')
+
+	writeField(record, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	record.WriteByte(',')
+	writeField(record, "level", level)
+	record.WriteByte(',')
+	writeField(record, "msg", msg)
+
+	fields := append(append([]interface{}{}, l.fields...), args...)
+
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+
+		var value interface{} = "!MISSING"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+
+		record.WriteByte(',')
+		writeField(record, key, value)
+	}
+
+	record.WriteString("}\n")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.out.Write(record.Bytes())
+}
+
+// Errors and durations are written the way they print
+func writeField(record *bytes.Buffer, key string, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	name, _ := json.Marshal(key)
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	record.Write(name)
+	record.WriteByte(':')
+	record.Write(data)
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger := NewLogger(out, LogWarn)
+
+	logger.Debug("Debug")
+	logger.Info("Info")
+	logger.Warn("Warn")
+	logger.Error("Error")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected warnings and errors only, got %v", lines)
+	}
+
+	var record map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &record)
+
+	if record["level"] != LogWarn || record["msg"] != "Warn" {
+		t.Errorf("Expected warning, got %v", record)
+	}
+}
+
+func TestLoggerFields(t *testing.T) {
+	out := new(bytes.Buffer)
+	gameId := uuid.New()
+
+	logger := NewLogger(out, LogInfo).With("game_id", gameId)
+	logger.Info("Move rejected", "type", Move, "error", errors.New("Illegal move"), "odd")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q", out.String())
+	}
+
+	expected := map[string]interface{}{
+		"game_id": gameId.String(),
+		"type":    string(Move),
+		"error":   "Illegal move",
+		"odd":     "!MISSING",
+	}
+
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected %v to be %v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestNilLoggerDiscards(t *testing.T) {
+	var logger *Logger
+
+	logger.With("player_id", uuid.New()).Error("Nobody listens")
+
+	if logger.Enabled(LogError) {
+		t.Error("Expected nil logger to be disabled")
+	}
+}
@@ -8,11 +8,13 @@ import (
 )
 
 type Match struct {
-	mutex *sync.Mutex
+	mutex    *sync.Mutex
+	canceled bool
 
 	Id          uuid.UUID
 	Players     []*Player
 	TimeControl TimeControl
+	Bots        bool
 
 	Done     chan bool
 	Ready    chan []*Player
@@ -41,13 +43,20 @@ func (m *Match) Cancel() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	close(m.Confirmed)
+	if !m.canceled {
+		m.canceled = true
+		close(m.Confirmed)
+	}
 }
 
 func (m *Match) Confirm(player *Player) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.canceled {
+		return
+	}
+
 	m.Confirmed <- player
 
 	player.Send(Response{
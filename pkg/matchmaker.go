@@ -8,19 +8,43 @@ import (
 )
 
 type MatchMaker struct {
+	bus     *Bus
 	mutex   *sync.Mutex
 	timeout time.Duration
+	colors  ColorPolicy
 	matches map[uuid.UUID]*Match
+	logger  *Logger
+
+	// confirmed and canceled matches
+	outcomes *CounterVec
 }
 
-func NewMatchMaker(timeout time.Duration) *MatchMaker {
+func NewMatchMaker(bus *Bus, timeout time.Duration) *MatchMaker {
 	return &MatchMaker{
+		bus:     bus,
 		timeout: timeout,
 		mutex:   new(sync.Mutex),
+		colors:  BalancedColors{},
 		matches: make(map[uuid.UUID]*Match),
+
+		outcomes: NewCounterVec(),
 	}
 }
 
+func (m *MatchMaker) SetLogger(logger *Logger) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.logger = logger
+}
+
+func (m *MatchMaker) log() *Logger {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.logger
+}
+
 func (m *MatchMaker) HasMatches() bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -35,13 +59,18 @@ func (m *MatchMaker) RemoveMatch(matchId uuid.UUID) {
 	delete(m.matches, matchId)
 }
 
-func (m *MatchMaker) CreateMatch(players []*Player, timeControl TimeControl) {
+// Bots tells whether players were paired in the bot queue
+func (m *MatchMaker) CreateMatch(players []*Player, timeControl TimeControl, bots bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	match := NewMatch(players, timeControl)
+	match.Bots = bots
 	m.matches[match.Id] = match
 
+	logger := m.logger.With("match_id", match.Id)
+	logger.Info("Match created", "players", PlayerIds(players), "time_control", timeControl)
+
 	go match.AskConfirmation()
 	go match.WaitConfirmation(m.timeout)
 
@@ -49,16 +78,23 @@ func (m *MatchMaker) CreateMatch(players []*Player, timeControl TimeControl) {
 		select {
 		case players := <-match.Ready:
 			m.RemoveMatch(match.Id)
+			logger.Info("Match confirmed")
+			m.outcomes.Inc(Labels{"outcome": "confirmed"})
 
-			Dispatcher <- Message{
+			m.bus.Publish(Message{
 				Type: CreateGame,
 				Payload: MatchParams{
-					Players:     players,
+					Id: match.Id,
+					Players: m.colors.Assign(MatchParams{
+						Players: players,
+					}),
 					TimeControl: match.TimeControl,
 				},
-			}
+			})
 		case requeue := <-match.Canceled:
 			m.RemoveMatch(match.Id)
+			logger.Info("Match canceled", "requeued", PlayerIds(requeue))
+			m.outcomes.Inc(Labels{"outcome": "canceled"})
 
 			for _, player := range match.Players {
 				player.Send(Response{
@@ -67,25 +103,57 @@ func (m *MatchMaker) CreateMatch(players []*Player, timeControl TimeControl) {
 			}
 
 			for _, player := range requeue {
-				Dispatcher <- Message{
+				m.bus.Publish(Message{
 					Type:   QueueUp,
 					Player: player,
 					Payload: map[string]interface{}{
-						"duration":  match.TimeControl.Duration,
-						"increment": match.TimeControl.Increment,
+						"duration":   match.TimeControl.Duration,
+						"increment":  match.TimeControl.Increment,
+						"delay":      match.TimeControl.Delay,
+						"delay_mode": match.TimeControl.DelayMode,
+						"stages":     match.TimeControl.Stages,
+						"variant":    match.TimeControl.Variant,
+						"bots":       match.Bots,
 					},
-				}
+				})
 			}
 		}
 	}()
 }
 
-func (m *MatchMaker) CancelMatch(matchId uuid.UUID) {
+// Cancel the match, returns false if there's no such match
+func (m *MatchMaker) CancelMatch(matchId uuid.UUID) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	match := m.matches[matchId]
+	if match == nil {
+		m.logger.Debug("Match not found", "match_id", matchId)
+		return false
+	}
+
 	match.Cancel()
+
+	return true
+}
+
+// Matches waiting for players to confirm
+func (m *MatchMaker) ListMatches() []MatchSummary {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	matches := []MatchSummary{}
+
+	for _, match := range m.matches {
+		matches = append(matches, MatchSummary{
+			MatchId:     match.Id,
+			Players:     PlayerIds(match.Players),
+			TimeControl: match.TimeControl,
+			Bots:        match.Bots,
+		})
+	}
+
+	return matches
 }
 
 func (m *MatchMaker) ConfirmMatch(matchId uuid.UUID, player *Player) {
@@ -93,6 +161,11 @@ func (m *MatchMaker) ConfirmMatch(matchId uuid.UUID, player *Player) {
 	defer m.mutex.Unlock()
 
 	match := m.matches[matchId]
+	if match == nil {
+		m.logger.Debug("Dropped message", "type", MatchConfirmed, "match_id", matchId, "player_id", playerId(player))
+		return
+	}
+
 	match.Confirm(player)
 }
 
@@ -109,19 +182,45 @@ func (m *MatchMaker) CancelPlayerMatches(player *Player) {
 	}
 }
 
+func (m *MatchMaker) Collect(metrics *MetricsWriter) {
+	m.mutex.Lock()
+	pending := len(m.matches)
+	m.mutex.Unlock()
+
+	metrics.Gauge("chess_pending_matches", "Matches waiting for players to confirm.", Sample{Value: float64(pending)})
+	metrics.Counter("chess_matches_total", "Matches by outcome, confirmed or canceled.", m.outcomes)
+}
+
+func (m *MatchMaker) Topics() []MessageType {
+	return []MessageType{MatchFound, MatchConfirmed, MatchDeclined, Disconnected}
+}
+
 func (m *MatchMaker) Process(event Message) {
 	switch event.Type {
 	case MatchFound:
-		params := event.Payload.(MatchParams)
-		m.CreateMatch(params.Players, params.TimeControl)
+		params, ok := event.Payload.(MatchParams)
+		if !ok {
+			m.log().Warn("Dropped message", "type", event.Type)
+			return
+		}
+
+		m.CreateMatch(params.Players, params.TimeControl, params.Bots)
 
-	case MatchConfirmed:
-		matchId, _ := uuid.Parse(event.Payload.(string))
-		m.ConfirmMatch(matchId, event.Player)
+	case MatchConfirmed, MatchDeclined:
+		matchId, err := parseId(event.Payload)
+		if err != nil {
+			event.Player.Send(Response{
+				Type: Error,
+				Text: "Invalid match id",
+			})
+			return
+		}
 
-	case MatchDeclined:
-		matchId, _ := uuid.Parse(event.Payload.(string))
-		m.CancelMatch(matchId)
+		if event.Type == MatchConfirmed {
+			m.ConfirmMatch(matchId, event.Player)
+		} else {
+			m.CancelMatch(matchId)
+		}
 
 	case Disconnected:
 		m.CancelPlayerMatches(event.Player)
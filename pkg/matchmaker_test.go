@@ -8,7 +8,8 @@ import (
 )
 
 func TestIgnoresQueueUp(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 
@@ -25,7 +26,8 @@ func TestIgnoresQueueUp(t *testing.T) {
 }
 
 func TestCreatesMatch(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -57,7 +59,8 @@ func TestCreatesMatch(t *testing.T) {
 }
 
 func TestAsksForConfirmation(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -93,7 +96,8 @@ func TestAsksForConfirmation(t *testing.T) {
 }
 
 func TestConcurrency(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -147,7 +151,9 @@ func TestConcurrency(t *testing.T) {
 }
 
 func TestRequeuesConfirmedAfterTimeout(t *testing.T) {
-	matchmaker := NewMatchMaker(200 * time.Millisecond)
+	bus := NewBus()
+	events := bus.Listen()
+	matchmaker := NewMatchMaker(bus, 200*time.Millisecond)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -197,7 +203,7 @@ func TestRequeuesConfirmedAfterTimeout(t *testing.T) {
 	<-p2.Outgoing
 
 	select {
-	case queueUp := <-Dispatcher:
+	case queueUp := <-events:
 		if queueUp.Type != QueueUp {
 			t.Error("Expected confirmed to be requeued", queueUp.Type)
 		}
@@ -215,7 +221,8 @@ func TestRequeuesConfirmedAfterTimeout(t *testing.T) {
 }
 
 func TestCancelsMatchIfNoConfirmation(t *testing.T) {
-	matchmaker := NewMatchMaker(200 * time.Millisecond)
+	bus := NewBus()
+	matchmaker := NewMatchMaker(bus, 200*time.Millisecond)
 	p1 := NewTestPlayer()
 
 	go matchmaker.Process(Message{
@@ -238,7 +245,9 @@ func TestCancelsMatchIfNoConfirmation(t *testing.T) {
 }
 
 func TestDispatchesGameStart(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	events := bus.Listen()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -282,7 +291,7 @@ func TestDispatchesGameStart(t *testing.T) {
 	}
 
 	select {
-	case res := <-Dispatcher:
+	case res := <-events:
 		if res.Type != CreateGame {
 			t.Errorf("Expected game start, got %v", res.Type)
 		}
@@ -308,7 +317,9 @@ func TestDispatchesGameStart(t *testing.T) {
 }
 
 func TestRefuseMatch(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	events := bus.Listen()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -363,7 +374,7 @@ func TestRefuseMatch(t *testing.T) {
 	<-p2.Outgoing
 
 	select {
-	case queueUp := <-Dispatcher:
+	case queueUp := <-events:
 		if queueUp.Type != QueueUp {
 			t.Error("Expected confirmed to be requeued", queueUp.Type)
 		}
@@ -385,7 +396,9 @@ func TestRefuseMatch(t *testing.T) {
 }
 
 func TestDisconnect(t *testing.T) {
-	matchmaker := NewMatchMaker(time.Second)
+	bus := NewBus()
+	events := bus.Listen()
+	matchmaker := NewMatchMaker(bus, time.Second)
 
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
@@ -443,7 +456,7 @@ func TestDisconnect(t *testing.T) {
 	<-p2.Outgoing
 
 	select {
-	case queueUp := <-Dispatcher:
+	case queueUp := <-events:
 		if queueUp.Type != QueueUp {
 			t.Error("Expected confirmed to be requeued", queueUp.Type)
 		}
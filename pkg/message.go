@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -8,25 +10,85 @@ type MessageType string
 type ResponseType string
 
 const (
-	QueueUp        MessageType = "queue_up"
-	Dequeue        MessageType = "dequeue"
-	Disconnected   MessageType = "disconnected"
-	MatchConfirmed MessageType = "match_confirmed"
-	MatchDeclined  MessageType = "match_declined"
-	CreateGame     MessageType = "create_game"
-	MatchFound     MessageType = "match_found"
-	Move           MessageType = "move_piece"
-	Resign         MessageType = "resign"
+	Connected        MessageType = "connected"
+	QueueUp          MessageType = "queue_up"
+	Dequeue          MessageType = "dequeue"
+	Disconnected     MessageType = "disconnected"
+	MatchConfirmed   MessageType = "match_confirmed"
+	MatchDeclined    MessageType = "match_declined"
+	CreateGame       MessageType = "create_game"
+	MatchFound       MessageType = "match_found"
+	Move             MessageType = "move_piece"
+	Resign           MessageType = "resign"
+	WatchGame        MessageType = "watch_game"
+	UnwatchGame      MessageType = "unwatch_game"
+	ListGames        MessageType = "list_games"
+	Chat             MessageType = "chat"
+	MuteChat         MessageType = "mute_chat"
+	UnmuteChat       MessageType = "unmute_chat"
+	ChallengePlayer  MessageType = "challenge"
+	AcceptChallenge  MessageType = "accept_challenge"
+	DeclineChallenge MessageType = "decline_challenge"
+	CancelChallenge  MessageType = "cancel_challenge"
+	JoinInvite       MessageType = "join_invite"
+	RequestRematch   MessageType = "rematch"
+	DeclineRematch   MessageType = "decline_rematch"
+	PlayBot          MessageType = "play_bot"
+	ResumeGame       MessageType = "resume_game"
+	ListQueues       MessageType = "list_queues"
 )
 
+// Messages clients may send, the rest are published by the server
+var ClientMessages = map[MessageType]bool{
+	QueueUp:          true,
+	Dequeue:          true,
+	MatchConfirmed:   true,
+	MatchDeclined:    true,
+	Move:             true,
+	Resign:           true,
+	WatchGame:        true,
+	UnwatchGame:      true,
+	ListGames:        true,
+	Chat:             true,
+	MuteChat:         true,
+	UnmuteChat:       true,
+	ChallengePlayer:  true,
+	AcceptChallenge:  true,
+	DeclineChallenge: true,
+	CancelChallenge:  true,
+	JoinInvite:       true,
+	RequestRematch:   true,
+	DeclineRematch:   true,
+	PlayBot:          true,
+	ResumeGame:       true,
+	ListQueues:       true,
+}
+
 const (
-	WaitForMatch     ResponseType = "wait_for_match"
-	ConfirmMatch     ResponseType = "confirm_match"
-	WaitOtherPlayers ResponseType = "wait_other_players"
-	MatchCanceled    ResponseType = "match_canceled"
-	StartGame        ResponseType = "start_game"
-	StartTurn        ResponseType = "start_turn"
-	GameOver         ResponseType = "game_over"
+	WaitForMatch      ResponseType = "wait_for_match"
+	ConfirmMatch      ResponseType = "confirm_match"
+	WaitOtherPlayers  ResponseType = "wait_other_players"
+	MatchCanceled     ResponseType = "match_canceled"
+	StartGame         ResponseType = "start_game"
+	StartTurn         ResponseType = "start_turn"
+	GameOver          ResponseType = "game_over"
+	GameState         ResponseType = "game_state"
+	MoveMade          ResponseType = "move_made"
+	SpectatorCount    ResponseType = "spectators"
+	GameList          ResponseType = "game_list"
+	ChatReceived      ResponseType = "chat"
+	Error             ResponseType = "error"
+	Welcome           ResponseType = "welcome"
+	ChallengeCreated  ResponseType = "challenge_created"
+	ChallengeReceived ResponseType = "challenge_received"
+	ChallengeCanceled ResponseType = "challenge_canceled"
+	RematchOffered    ResponseType = "rematch_offered"
+	RematchCanceled   ResponseType = "rematch_canceled"
+	ServerShutdown    ResponseType = "server_shutdown"
+	GameSuspended     ResponseType = "game_suspended"
+	QueueList         ResponseType = "queue_list"
+	QueueFlushed      ResponseType = "queue_flushed"
+	Announcement      ResponseType = "announcement"
 )
 
 type Message struct {
@@ -42,37 +104,159 @@ type Response struct {
 	Payload interface{}  `json:"payload"`
 }
 
+type MatchSummary struct {
+	MatchId     uuid.UUID   `json:"match_id"`
+	Players     []uuid.UUID `json:"players"`
+	TimeControl TimeControl `json:"time_control"`
+	Bots        bool        `json:"bots"`
+}
+
+type VersionResponse struct {
+	Version string `json:"version"`
+	Go      string `json:"go"`
+}
+
+// Token lets players resume correspondence games, keep it secret
 type GameStart struct {
 	GameId      uuid.UUID   `json:"game_id"`
 	Color       Color       `json:"color"`
 	TimeControl TimeControl `json:"time_control"`
+	Fen         string      `json:"fen"`
+	Token       string      `json:"token,omitempty"`
 }
 
+// Games still running at the deadline are suspended
+type ShutdownNotice struct {
+	Deadline time.Time `json:"deadline"`
+}
+
+// Resume the game with the token once the server is back
+type SuspendedGame struct {
+	GameId uuid.UUID `json:"game_id"`
+	Token  string    `json:"token"`
+}
+
+type ResumeParams struct {
+	GameId string `json:"game_id" mapstructure:"game_id"`
+	Token  string `json:"token"`
+}
+
+// Drop names a piece from the player's reserve to put on To
 type MovePiece struct {
 	From   string `json:"from"`
 	To     string `json:"to"`
+	Drop   string `json:"drop"`
 	GameId string `json:"game_id" mapstructure:"game_id"`
 }
 
 type MoveResponse struct {
 	From   string    `json:"from"`
 	To     string    `json:"to"`
+	Drop   string    `json:"drop,omitempty"`
 	Time   int64     `json:"time"`
 	GameId uuid.UUID `json:"game_id"`
 }
 
 type GameOverResponse struct {
-	Reason string    `json:"reason"`
+	Reason      string    `json:"reason"`
+	GameId      uuid.UUID `json:"game_id"`
+	Winner      bool      `json:"winner"`
+	WinnerColor Color     `json:"winner_color,omitempty"`
+}
+
+type GameStateResponse struct {
+	GameId     uuid.UUID `json:"game_id"`
+	Fen        string    `json:"fen"`
+	White      int64     `json:"white"`
+	Black      int64     `json:"black"`
+	Moves      []string  `json:"moves"`
+	Spectators int       `json:"spectators"`
+}
+
+type SpectatorsResponse struct {
 	GameId uuid.UUID `json:"game_id"`
-	Winner bool      `json:"winner"`
+	Count  int       `json:"count"`
+}
+
+type GameSummary struct {
+	GameId      uuid.UUID     `json:"game_id"`
+	White       PlayerSummary `json:"white"`
+	Black       PlayerSummary `json:"black"`
+	TimeControl TimeControl   `json:"time_control"`
+	Moves       int           `json:"moves"`
+	Turn        Color         `json:"turn"`
+	Spectators  int           `json:"spectators"`
+	StartedAt   time.Time     `json:"started_at"`
+}
+
+type PlayerSummary struct {
+	Id     uuid.UUID `json:"id"`
+	Rating int       `json:"rating"`
+	Time   int64     `json:"time"`
+}
+
+type ListGamesParams struct {
+	Sort string `json:"sort"`
 }
 
+type ChatMessage struct {
+	GameId  string `json:"game_id" mapstructure:"game_id"`
+	Channel string `json:"channel"`
+	Text    string `json:"text"`
+}
+
+type ChatLine struct {
+	GameId  uuid.UUID `json:"game_id"`
+	Player  uuid.UUID `json:"player"`
+	Channel string    `json:"channel"`
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+}
+
+type ChallengeParams struct {
+	Opponent    string      `json:"opponent"`
+	Color       Color       `json:"color"`
+	TimeControl TimeControl `json:"time_control" mapstructure:"time_control"`
+}
+
+type ChallengeResponse struct {
+	ChallengeId uuid.UUID   `json:"challenge_id"`
+	Challenger  uuid.UUID   `json:"challenger"`
+	Color       Color       `json:"color"`
+	TimeControl TimeControl `json:"time_control"`
+	Code        string      `json:"code,omitempty"`
+}
+
+// Empty variant means standard chess
+// Increment is Fischer's, Delay is simple unless DelayMode says
+// bronstein and Stages adds time after a number of moves, see ParseStages.
+// Days makes it a correspondence game with that many days per move
 type TimeControl struct {
 	Duration  string `json:"duration"`
 	Increment string `json:"increment"`
+	Delay     string `json:"delay,omitempty"`
+	DelayMode string `json:"delay_mode,omitempty" mapstructure:"delay_mode"`
+	Stages    string `json:"stages,omitempty"`
+	Days      int    `json:"days,omitempty"`
+	Variant   string `json:"variant"`
 }
 
+// Players[0] may ask for a color through Color
 type MatchParams struct {
+	// match, challenge or game the players come from, their
+	// messages are ordered by it on the bus
+	Id          uuid.UUID   `json:"id"`
 	Players     []*Player   `json:"players"`
 	TimeControl TimeControl `json:"time_control"`
+	Color       Color       `json:"color"`
+	Bots        bool        `json:"bots"`
+}
+
+// Level of the bot, from 1 up to the number of BotLevels,
+// Engine names a registered UCI engine to play instead of ours
+type PlayBotParams struct {
+	Level       int         `json:"level"`
+	Engine      string      `json:"engine"`
+	Color       Color       `json:"color"`
+	TimeControl TimeControl `json:"time_control" mapstructure:"time_control"`
 }
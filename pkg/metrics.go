@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds in seconds of the buckets move latencies fall in
+var LATENCY_BUCKETS = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Collector is implemented by handlers with metrics to expose
+// on /metrics, they're collected on every scrape
+type Collector interface {
+	Collect(metrics *MetricsWriter)
+}
+
+// Label names and values of a sample
+type Labels map[string]string
+
+// Labels as written after metric names, e.g. {reason="Timeout"}
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(l[name]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// Counters going up by label set
+type CounterVec struct {
+	mutex   *sync.Mutex
+	samples map[string]*Sample
+}
+
+func NewCounterVec() *CounterVec {
+	return &CounterVec{
+		mutex:   new(sync.Mutex),
+		samples: make(map[string]*Sample),
+	}
+}
+
+func (c *CounterVec) Inc(labels Labels) {
+	c.Add(labels, 1)
+}
+
+func (c *CounterVec) Add(labels Labels, value float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := labels.String()
+
+	if sample, ok := c.samples[key]; ok {
+		sample.Value += value
+		return
+	}
+
+	c.samples[key] = &Sample{Labels: labels, Value: value}
+}
+
+// Counts so far, ordered by labels
+func (c *CounterVec) Samples() []Sample {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	samples := make([]Sample, 0, len(c.samples))
+	for _, sample := range c.samples {
+		samples = append(samples, *sample)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Labels.String() < samples[j].Labels.String()
+	})
+
+	return samples
+}
+
+// Distribution of observed values over fixed buckets
+type Histogram struct {
+	mutex   *sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		mutex:   new(sync.Mutex),
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+// Observe the seconds gone by since start
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// MetricsWriter writes metrics in the Prometheus text format
+type MetricsWriter struct {
+	out io.Writer
+}
+
+func NewMetricsWriter(out io.Writer) *MetricsWriter {
+	return &MetricsWriter{out: out}
+}
+
+func (w *MetricsWriter) Write(name, kind, help string, samples ...Sample) {
+	fmt.Fprintf(w.out, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w.out, "# TYPE %s %s\n", name, kind)
+
+	for _, sample := range samples {
+		fmt.Fprintf(w.out, "%s%s %s\n", name, sample.Labels, formatValue(sample.Value))
+	}
+}
+
+func (w *MetricsWriter) Gauge(name, help string, samples ...Sample) {
+	w.Write(name, "gauge", help, samples...)
+}
+
+func (w *MetricsWriter) Counter(name, help string, counter *CounterVec) {
+	w.Write(name, "counter", help, counter.Samples()...)
+}
+
+func (w *MetricsWriter) Histogram(name, help string, histogram *Histogram) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	samples := []Sample{}
+
+	for i, bound := range histogram.buckets {
+		samples = append(samples, Sample{
+			Labels: Labels{"le": formatValue(bound)},
+			Value:  float64(histogram.counts[i]),
+		})
+	}
+
+	samples = append(samples, Sample{
+		Labels: Labels{"le": "+Inf"},
+		Value:  float64(histogram.count),
+	})
+
+	fmt.Fprintf(w.out, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w.out, "# TYPE %s histogram\n", name)
+
+	for _, sample := range samples {
+		fmt.Fprintf(w.out, "%s_bucket%s %s\n", name, sample.Labels, formatValue(sample.Value))
+	}
+
+	fmt.Fprintf(w.out, "%s_sum %s\n", name, formatValue(histogram.sum))
+	fmt.Fprintf(w.out, "%s_count %d\n", name, histogram.count)
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
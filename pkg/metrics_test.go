@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	counter := NewCounterVec()
+	counter.Inc(Labels{"reason": "Timeout"})
+	counter.Inc(Labels{"reason": "Checkmate"})
+	counter.Add(Labels{"reason": "Timeout"}, 2)
+
+	NewMetricsWriter(out).Counter("chess_game_results_total", "Finished games by reason.", counter)
+
+	expected := `# HELP chess_game_results_total Finished games by reason.
+# TYPE chess_game_results_total counter
+chess_game_results_total{reason="Checkmate"} 1
+chess_game_results_total{reason="Timeout"} 3
+`
+
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	histogram := NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	NewMetricsWriter(out).Histogram("chess_move_duration_seconds", "Move latency.", histogram)
+
+	expected := `# HELP chess_move_duration_seconds Move latency.
+# TYPE chess_move_duration_seconds histogram
+chess_move_duration_seconds_bucket{le="0.1"} 1
+chess_move_duration_seconds_bucket{le="1"} 2
+chess_move_duration_seconds_bucket{le="+Inf"} 3
+chess_move_duration_seconds_sum 2.55
+chess_move_duration_seconds_count 3
+`
+
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
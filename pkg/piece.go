@@ -23,8 +23,12 @@ type Movement interface {
 	IsAllowed(from, to string, color Color, board *Board) []AllowedMove
 }
 
+// Castling towards either rook, the king may be sent to its
+// destination file or to the square of the rook it castles with
 type Castle struct {
-	origin Square
+	origin    Square
+	queenRook rune
+	kingRook  rune
 }
 
 func (c Castle) CanCapture(from, to string, color Color, board *Board) bool {
@@ -39,55 +43,83 @@ func (c Castle) IsValid(from, to string) bool {
 	source, _ := parseSquare(from)
 	dest, _ := parseSquare(to)
 
-	colDistance := Abs(int(source.col - dest.col))
-	rowDistance := source.row - dest.row
+	_, _, _, ok := c.side(dest)
 
-	return from == c.origin.String() && rowDistance == 0 && colDistance == 2
+	return source == c.origin && dest.row == c.origin.row && ok
+}
+
+// Rook file and king and rook destinations for the castle towards dest
+func (c Castle) side(dest Square) (rune, rune, rune, bool) {
+	switch {
+	case dest.col == c.kingRook:
+		return c.kingRook, 'g', 'f', true
+	case dest.col == c.queenRook:
+		return c.queenRook, 'c', 'd', true
+	case dest.col == 'g' && dest != c.origin:
+		return c.kingRook, 'g', 'f', true
+	case dest.col == 'c' && dest != c.origin:
+		return c.queenRook, 'c', 'd', true
+	}
+	return 0, 0, 0, false
 }
 
 func (c Castle) IsAllowed(from, to string, color Color, board *Board) []AllowedMove {
 	source, _ := parseSquare(from)
 	dest, _ := parseSquare(to)
 
-	if dest.col == 'g' && dest.row == c.origin.row {
-		for square := source.Right(); square.col <= 'h'; square = square.Right() {
-			if len(board.IsThreatened(square.String(), color)) > 0 {
-				return []AllowedMove{}
-			}
+	rookFile, kingFile, rookDest, ok := c.side(dest)
+	if !ok || dest.row != c.origin.row {
+		return []AllowedMove{}
+	}
 
-			piece := board.Square(square.String())
-			if piece != Empty() {
-				if square.col != 'h' || piece != Rook(color) {
-					return []AllowedMove{}
-				}
-			}
+	rook := Square{col: rookFile, row: c.origin.row}
+	if board.Square(rook.String()) != Rook(color) {
+		return []AllowedMove{}
+	}
+
+	files := []rune{source.col, kingFile, rookFile, rookDest}
+	first, last := files[0], files[0]
+
+	for _, file := range files {
+		if file < first {
+			first = file
+		}
+		if file > last {
+			last = file
 		}
+	}
+
+	// only the king and the castling rook may stand in the way
+	for col := first; col <= last; col++ {
+		square := Square{col: col, row: c.origin.row}
 
-		return []AllowedMove{
-			{From: source, To: dest},
-			{From: Square{col: 'h', row: c.origin.row}, To: Square{col: 'f', row: c.origin.row}},
+		if square != source && square != rook && board.Square(square.String()) != Empty() {
+			return []AllowedMove{}
 		}
-	} else if dest.col == 'c' && dest.row == c.origin.row {
-		for square := source.Left(); square.col >= 'a'; square = square.Left() {
-			if len(board.IsThreatened(square.String(), color)) > 0 {
-				return []AllowedMove{}
-			}
+	}
 
-			piece := board.Square(square.String())
-			if piece != Empty() {
-				if square.col != 'a' || piece != Rook(color) {
-					return []AllowedMove{}
-				}
-			}
+	step := 1
+	if kingFile < source.col {
+		step = -1
+	}
+
+	// the king may not castle out of, through or into check
+	for col := source.col; ; col += rune(step) {
+		square := Square{col: col, row: c.origin.row}
+
+		if len(board.IsThreatened(square.String(), color)) > 0 {
+			return []AllowedMove{}
 		}
 
-		return []AllowedMove{
-			{From: source, To: dest},
-			{From: Square{col: 'a', row: c.origin.row}, To: Square{col: 'd', row: c.origin.row}},
+		if col == kingFile {
+			break
 		}
 	}
 
-	return []AllowedMove{}
+	return []AllowedMove{
+		{From: source, To: Square{col: kingFile, row: c.origin.row}},
+		{From: rook, To: Square{col: rookDest, row: c.origin.row}},
+	}
 }
 
 type Forward struct {
@@ -103,7 +135,8 @@ func (f Forward) CanCapture(from, to string, color Color, board *Board) bool {
 		piece := board.Square(to)
 		colDistance := int(dest.col - source.col)
 
-		return Abs(colDistance) == Abs(f.squares) && (piece != Empty() && piece.Color != color)
+		return Abs(colDistance) == Abs(f.squares) && (piece != Empty() && piece.Color != color) &&
+			board.variant.AllowsCapture(board, source, dest)
 	}
 
 	return false
@@ -216,6 +249,10 @@ func (s Straight) IsAllowed(from, to string, color Color, board *Board) []Allowe
 			if piece.Color == color || cur != moveRange.until {
 				return []AllowedMove{}
 			}
+
+			if !board.variant.AllowsCapture(board, moveRange.from, cur) {
+				return []AllowedMove{}
+			}
 		}
 	}
 
@@ -296,6 +333,10 @@ func (d Diagonal) IsAllowed(from, to string, color Color, board *Board) []Allowe
 			if piece.Color == color || cur != moveRange.until {
 				return []AllowedMove{}
 			}
+
+			if !board.variant.AllowsCapture(board, moveRange.from, cur) {
+				return []AllowedMove{}
+			}
 		}
 	}
 
@@ -355,6 +396,10 @@ func (l LMovement) IsAllowed(from, to string, color Color, board *Board) []Allow
 		source, _ := parseSquare(from)
 		dest, _ := parseSquare(to)
 
+		if piece != Empty() && !board.variant.AllowsCapture(board, source, dest) {
+			return []AllowedMove{}
+		}
+
 		return []AllowedMove{{
 			From: source,
 			To:   dest,
@@ -465,6 +510,23 @@ func CreatePiece(name string, color Color, movement Movement) Piece {
 	}
 }
 
+// Piece other than the king from its uppercase notation
+func PieceFromNotation(notation rune, color Color) Piece {
+	switch notation {
+	case 'R':
+		return Rook(color)
+	case 'N':
+		return Knight(color)
+	case 'B':
+		return Bishop(color)
+	case 'Q':
+		return Queen(color)
+	case 'P':
+		return Pawn(color)
+	}
+	return Empty()
+}
+
 func Empty() Piece {
 	return CreatePiece("", White, nil)
 }
@@ -484,15 +546,21 @@ func Queen(color Color) Piece {
 	return CreatePiece("Q", color, movement)
 }
 func King(color Color) Piece {
-	square := "e1"
+	return CastlingKing(color, 'e', 'a', 'h')
+}
+
+// King starting on file which may castle with the rooks
+// starting on the queen and king side files
+func CastlingKing(color Color, file, queenRook, kingRook rune) Piece {
+	row := 0
 	if color == Black {
-		square = "e8"
+		row = 7
 	}
 
-	origin, _ := parseSquare(square)
+	origin := Square{col: file, row: row}
 
 	movement := Combined{
-		[]Movement{Straight{1}, Castle{origin}, Diagonal{1}},
+		[]Movement{Straight{1}, Castle{origin, queenRook, kingRook}, Diagonal{1}},
 	}
 	return CreatePiece("K", color, movement)
 }
@@ -438,7 +438,7 @@ func TestSeesStraight(t *testing.T) {
 
 func TestWhiteShortCastleIsAllowed(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	if len(castle.IsAllowed("e1", "g1", White, board)) > 0 {
@@ -461,7 +461,7 @@ func TestWhiteShortCastleIsAllowed(t *testing.T) {
 
 func TestWhiteLongCastleIsAllowed(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	if len(castle.IsAllowed("e1", "c1", White, board)) > 0 {
@@ -491,7 +491,7 @@ func TestWhiteLongCastleIsAllowed(t *testing.T) {
 
 func TestBlackShortCastleIsAllowed(t *testing.T) {
 	origin, _ := parseSquare("e8")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	if len(castle.IsAllowed("e8", "g8", Black, board)) > 0 {
@@ -514,7 +514,7 @@ func TestBlackShortCastleIsAllowed(t *testing.T) {
 
 func TestBlackLongCastleIsAllowed(t *testing.T) {
 	origin, _ := parseSquare("e8")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	if len(castle.IsAllowed("e8", "c8", Black, board)) > 0 {
@@ -544,7 +544,7 @@ func TestBlackLongCastleIsAllowed(t *testing.T) {
 
 func TestCastleNoRookOnH8(t *testing.T) {
 	origin, _ := parseSquare("e8")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	if len(castle.IsAllowed("e8", "g8", Black, board)) > 0 {
@@ -576,7 +576,7 @@ func TestCastleNoRookOnH8(t *testing.T) {
 
 func TestCannotCastleIfNotOnE1(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	board.Move("e2", "e4")
@@ -594,7 +594,7 @@ func TestCannotCastleIfNotOnE1(t *testing.T) {
 
 func TestCannotCastleIfThreatenedF1(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	board.Move("e2", "e4")
@@ -612,7 +612,7 @@ func TestCannotCastleIfThreatenedF1(t *testing.T) {
 
 func TestCannotCastleIfThreatenedG1(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	board.Move("e2", "e4")
@@ -630,7 +630,7 @@ func TestCannotCastleIfThreatenedG1(t *testing.T) {
 
 func TestCannotCastleIfThreatenedC1(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	board.Move("d2", "d4")
@@ -649,7 +649,7 @@ func TestCannotCastleIfThreatenedC1(t *testing.T) {
 
 func TestCannotCastleIfThreatenedD1(t *testing.T) {
 	origin, _ := parseSquare("e1")
-	castle := Castle{origin}
+	castle := Castle{origin, 'a', 'h'}
 	board := NewBoard()
 
 	board.Move("d2", "d4")
@@ -1,43 +1,131 @@
 package pkg
 
 import (
+	"net"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// Rating assigned to new players
+const DEFAULT_RATING = 1500
+
+// Amount of games considered when balancing colors
+const COLOR_HISTORY = 10
+
+// Closes the connection once it's written, see Disconnect
+const goingAway ResponseType = "going_away"
+
+// How often connections are pinged to measure latency
+const PING_INTERVAL = 5 * time.Second
+
 type Player struct {
-	Id uuid.UUID
+	Id     uuid.UUID
+	Rating int
+
+	// programs playing through a bot account or the server's own bots
+	Bot bool
 
 	Incoming chan Message
 	Outgoing chan Response
 
-	socket *websocket.Conn
+	socket  *websocket.Conn
+	addr    string
+	colors  []Color
+	latency time.Duration
+	ping    string
+	pinged  time.Time
+	penalty time.Time
+	muted   time.Time
+	logger  *Logger
+	mutex   *sync.Mutex
+
+	// run before Outgoing is closed, see OnClose
+	closers    map[int]func()
+	nextCloser int
+
+	// both reading and writing close the player when they fail
+	closing sync.Once
 }
 
-func NewPlayer(socket *websocket.Conn) *Player {
+// Players connected through a bot account play as the account,
+// from addr, records about the player go to logger with their id
+func NewPlayer(socket *websocket.Conn, addr string, account *BotAccount, logger *Logger) *Player {
+	id := uuid.New()
+	if account != nil {
+		id = account.Id
+	}
+
 	player := &Player{
-		Id: uuid.New(),
+		Id:     id,
+		Rating: DEFAULT_RATING,
+		Bot:    account != nil,
 
 		Incoming: make(chan Message),
 		Outgoing: make(chan Response),
 
 		socket: socket,
+		addr:   addr,
+		colors: []Color{},
+		logger: logger.With("player_id", id),
+		mutex:  new(sync.Mutex),
 	}
 
+	socket.SetPongHandler(player.Pong)
+
 	go player.Read()
 	go player.Write()
+	go player.Ping()
 
 	return player
 }
 
 func (p *Player) Close() {
-	p.socket.WriteControl(
-		websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
-		time.Now().Add(time.Second),
-	)
+	p.closing.Do(p.close)
+}
+
+// Run f once the player closes, before sending to it panics,
+// until the returned cancel is called
+func (p *Player) OnClose(f func()) (cancel func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closers == nil {
+		p.closers = make(map[int]func())
+	}
+
+	id := p.nextCloser
+	p.nextCloser++
+	p.closers[id] = f
+
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		delete(p.closers, id)
+	}
+}
+
+func (p *Player) close() {
+	p.mutex.Lock()
+	closers := p.closers
+	p.closers = nil
+	p.mutex.Unlock()
+
+	for _, f := range closers {
+		f()
+	}
+
+	// bots don't have a socket
+	if p.socket != nil {
+		p.socket.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second),
+		)
+	}
 
 	close(p.Incoming)
 
@@ -46,6 +134,173 @@ func (p *Player) Close() {
 	close(p.Outgoing)
 }
 
+// Say goodbye with a websocket close code and reason once everything
+// sent before went out, the player is closed when the client answers
+// or after CLOSE_TIMEOUT
+func (p *Player) Disconnect(code int, reason string) {
+	// the player may be closing already, which panics
+	defer func() {
+		recover()
+	}()
+
+	p.Send(Response{Type: goingAway, Text: reason, Payload: code})
+}
+
+// Server's own bots, played from this process rather than a socket
+func (p *Player) IsEngine() bool {
+	return p.Bot && p.socket == nil
+}
+
+// IP address the player connected from
+func (p *Player) Addr() string {
+	return p.addr
+}
+
+// Keep the player from chatting for d
+func (p *Player) Mute(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.muted = time.Now().Add(d)
+}
+
+func (p *Player) Unmute() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.muted = time.Time{}
+}
+
+func (p *Player) IsMuted() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return time.Now().Before(p.muted)
+}
+
+// Remember the color played, keeping only the most recent games
+func (p *Player) RecordColor(color Color) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.colors = append(p.colors, color)
+
+	if len(p.colors) > COLOR_HISTORY {
+		p.colors = p.colors[len(p.colors)-COLOR_HISTORY:]
+	}
+}
+
+// Games played as white minus games played as black
+func (p *Player) ColorBalance() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	balance := 0
+
+	for _, color := range p.colors {
+		if color == White {
+			balance++
+		} else {
+			balance--
+		}
+	}
+
+	return balance
+}
+
+// Hold the player back in queues for d on top of any
+// penalty still running, e.g. for letting games abort
+func (p *Player) Penalize(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.penalty.Before(time.Now()) {
+		p.penalty = time.Now()
+	}
+
+	p.penalty = p.penalty.Add(d)
+}
+
+// When the player may be paired again
+func (p *Player) PenalizedUntil() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.penalty
+}
+
+// Round-trip time to the client, averaged over recent pings
+func (p *Player) Latency() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.latency
+}
+
+// Round trips longer than the ping interval aren't measured,
+// they're capped there
+func (p *Player) RecordLatency(rtt time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if rtt > PING_INTERVAL {
+		rtt = PING_INTERVAL
+	}
+
+	if p.latency == 0 {
+		p.latency = rtt
+	} else {
+		p.latency = (p.latency*3 + rtt) / 4
+	}
+}
+
+// Ping the client periodically until the connection is gone,
+// pongs tell the rtt
+func (p *Player) Ping() {
+	ticker := time.NewTicker(PING_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		nonce := p.nextPing()
+		err := p.socket.WriteControl(websocket.PingMessage, []byte(nonce), time.Now().Add(PING_INTERVAL))
+
+		if err != nil {
+			p.logger.Debug("Ping failed", "error", err)
+			return
+		}
+	}
+}
+
+// Remember when the ping carrying a fresh nonce went out, only the
+// latest is outstanding
+func (p *Player) nextPing() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.ping = uuid.New().String()
+	p.pinged = time.Now()
+
+	return p.ping
+}
+
+// Time the round trip of the outstanding ping, pongs are echoed by
+// the client so anything else it sends is ignored
+func (p *Player) Pong(data string) error {
+	p.mutex.Lock()
+	known := p.ping != "" && data == p.ping
+	if known {
+		p.ping = ""
+	}
+	sent := p.pinged
+	p.mutex.Unlock()
+
+	if known {
+		p.RecordLatency(time.Since(sent))
+	}
+
+	return nil
+}
+
 func (p *Player) Send(response Response) {
 	p.Outgoing <- response
 }
@@ -59,18 +314,32 @@ func (p *Player) Read() {
 		err := p.socket.ReadJSON(&msg)
 
 		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				p.logger.Warn("Read failed", "error", err)
+			}
+
 			p.Incoming <- Message{
 				Type: Disconnected,
 			}
 			break
 		}
 
+		p.logger.Debug("Message received", "type", msg.Type)
+
+		// only the socket closing disconnects the player
+		if msg.Type == Disconnected {
+			continue
+		}
+
 		p.Incoming <- msg
 	}
 }
 
 // Write responses to client
 func (p *Player) Write() {
+	// nothing goes out after the close frame
+	gone := false
+
 	for {
 		msg, ok := <-p.Outgoing
 
@@ -78,10 +347,61 @@ func (p *Player) Write() {
 			break
 		}
 
+		if gone {
+			continue
+		}
+
+		if msg.Type == goingAway {
+			gone = true
+			p.socket.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(msg.Payload.(int), msg.Text),
+				time.Now().Add(time.Second),
+			)
+			time.AfterFunc(CLOSE_TIMEOUT, func() {
+				p.socket.Close()
+			})
+			continue
+		}
+
 		err := p.socket.WriteJSON(msg)
 
+		// reading fails once the socket is closed, which closes
+		// the player, closing it here could leave Read sending
+		// on a closed channel
 		if err != nil {
-			p.Close()
+			p.logger.Warn("Write failed", "type", msg.Type, "error", err)
+			p.socket.Close()
+			gone = true
 		}
 	}
 }
+
+// Ids of players, for logging
+func PlayerIds(players []*Player) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(players))
+	for _, player := range players {
+		ids = append(ids, player.Id)
+	}
+
+	return ids
+}
+
+// Id of player, nil when there's none
+func playerId(player *Player) interface{} {
+	if player == nil {
+		return nil
+	}
+
+	return player.Id
+}
+
+// Host part of a remote address, the address itself if there's none
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
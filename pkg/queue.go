@@ -2,11 +2,15 @@ package pkg
 
 import (
 	"sync"
+	"time"
 )
 
 type node struct {
 	Player *Player
 	next   *node
+
+	// penalized players wait before they can be paired
+	ready time.Time
 }
 
 type Queue struct {
@@ -26,7 +30,10 @@ func (q *Queue) Push(player *Player) {
 	q.mut.Lock()
 	defer q.mut.Unlock()
 
-	node := &node{Player: player}
+	node := &node{
+		Player: player,
+		ready:  player.PenalizedUntil(),
+	}
 
 	if q.head == nil {
 		q.head = node
@@ -59,10 +66,40 @@ func (q *Queue) Pop() *Player {
 	return player
 }
 
+// Pop the first count players that may be paired, in queue order,
+// returns nil while there aren't enough of them
+func (q *Queue) PopReady(count int) []*Player {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	now := time.Now()
+
+	players := []*Player{}
+	for cur := q.head; cur != nil && len(players) < count; cur = cur.next {
+		if !cur.ready.After(now) {
+			players = append(players, cur.Player)
+		}
+	}
+
+	if len(players) < count {
+		return nil
+	}
+
+	for _, player := range players {
+		q.remove(player)
+	}
+
+	return players
+}
+
 func (q *Queue) Remove(player *Player) {
 	q.mut.Lock()
 	defer q.mut.Unlock()
 
+	q.remove(player)
+}
+
+func (q *Queue) remove(player *Player) {
 	var prev *node
 
 	for cur := q.head; cur != nil; cur = cur.next {
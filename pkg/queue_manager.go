@@ -1,70 +1,358 @@
 package pkg
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mitchellh/mapstructure"
 )
 
 const MAX_PLAYERS = 2
 
+// Bot accounts are only paired in bot queues, which humans
+// may join by asking for bots when queueing up
+type QueueKey struct {
+	TimeControl TimeControl
+	Bots        bool
+}
+
+// Players name a catalog entry through Queue or give its time control
+type QueueOptions struct {
+	Queue string `json:"queue"`
+	Bots  bool   `json:"bots"`
+}
+
+// Waiting players of a queue, as listed to players
+type QueueInfo struct {
+	Name        string      `json:"name"`
+	TimeControl TimeControl `json:"time_control"`
+	Bots        bool        `json:"bots"`
+	Waiting     int         `json:"waiting"`
+}
+
 type QueueManager struct {
+	bus   *Bus
 	mutex *sync.Mutex
-	queue map[TimeControl]*Queue
+	queue map[QueueKey]*Queue
+
+	draining bool
+	logger   *Logger
+
+	// time controls players may queue up for
+	catalog []CatalogEntry
 }
 
-func NewQueueManager() *QueueManager {
+func NewQueueManager(bus *Bus) *QueueManager {
 	return &QueueManager{
+		bus:   bus,
 		mutex: new(sync.Mutex),
-		queue: make(map[TimeControl]*Queue),
+		queue: make(map[QueueKey]*Queue),
+
+		catalog: DefaultCatalog,
 	}
 }
 
-func (q *QueueManager) GetQueue(event Message) (*Queue, TimeControl) {
+func (q *QueueManager) GetQueue(event Message) (*Queue, QueueKey, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
+	if q.draining {
+		return nil, QueueKey{}, errors.New("Server is shutting down")
+	}
+
 	var timeControl TimeControl
 	mapstructure.Decode(event.Payload, &timeControl)
 
-	queue := q.queue[timeControl]
+	var options QueueOptions
+	mapstructure.Decode(event.Payload, &options)
+
+	if timeControl.Variant == Standard {
+		timeControl.Variant = ""
+	}
+
+	if !IsVariant(timeControl.Variant) {
+		return nil, QueueKey{}, errors.New("Unknown variant")
+	}
+
+	var entry CatalogEntry
+	var ok bool
+
+	if options.Queue != "" {
+		if entry, ok = q.findNamed(options.Queue); !ok {
+			return nil, QueueKey{}, errors.New("Unknown queue")
+		}
+	} else {
+		if err := ValidateTimeControl(timeControl); err != nil {
+			return nil, QueueKey{}, errors.New("Invalid time control")
+		}
+
+		if entry, ok = FindCatalogEntry(q.catalog, timeControl); !ok {
+			return nil, QueueKey{}, errors.New("Time control not allowed")
+		}
+	}
+
+	// however players spell it, the same clock is the same queue
+	variant := timeControl.Variant
+	timeControl = entry.TimeControl
+	timeControl.Variant = variant
+
+	key := QueueKey{
+		TimeControl: timeControl,
+		Bots:        options.Bots || event.Player.Bot,
+	}
+
+	queue := q.queue[key]
 
 	if queue == nil {
 		queue = NewQueue()
-		q.queue[timeControl] = queue
+		q.queue[key] = queue
+	}
+
+	return queue, key, nil
+}
+
+func (q *QueueManager) SetLogger(logger *Logger) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.logger = logger
+}
+
+func (q *QueueManager) log() *Logger {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.logger
+}
+
+// Only let players queue up for the time controls of catalog
+func (q *QueueManager) SetCatalog(catalog []CatalogEntry) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.catalog = catalog
+}
+
+func (q *QueueManager) findNamed(name string) (CatalogEntry, bool) {
+	for _, entry := range q.catalog {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+
+	return CatalogEntry{}, false
+}
+
+// Queues players are or were waiting in
+func (q *QueueManager) Queues() []*Queue {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queues := make([]*Queue, 0, len(q.queue))
+	for _, queue := range q.queue {
+		queues = append(queues, queue)
+	}
+
+	return queues
+}
+
+// Every catalog entry, then the variant and bot queues players
+// are waiting in
+func (q *QueueManager) ListQueues() []QueueInfo {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queues := []QueueInfo{}
+	listed := make(map[QueueKey]bool)
+
+	for _, entry := range q.catalog {
+		key := QueueKey{TimeControl: entry.TimeControl}
+		key.TimeControl.Variant = ""
+		listed[key] = true
+
+		info := QueueInfo{Name: entry.Name, TimeControl: key.TimeControl}
+		if queue := q.queue[key]; queue != nil {
+			info.Waiting = queue.Length()
+		}
+
+		queues = append(queues, info)
+	}
+
+	others := []QueueInfo{}
+
+	for key, queue := range q.queue {
+		waiting := queue.Length()
+		if listed[key] || waiting == 0 {
+			continue
+		}
+
+		entry, _ := FindCatalogEntry(q.catalog, key.TimeControl)
+		name := entry.Name
+		if key.TimeControl.Variant != "" {
+			name += " " + key.TimeControl.Variant
+		}
+
+		others = append(others, QueueInfo{
+			Name:        name,
+			TimeControl: key.TimeControl,
+			Bots:        key.Bots,
+			Waiting:     waiting,
+		})
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		if others[i].Name != others[j].Name {
+			return others[i].Name < others[j].Name
+		}
+		return !others[i].Bots
+	})
+
+	return append(queues, others...)
+}
+
+func (q *QueueManager) Collect(metrics *MetricsWriter) {
+	samples := []Sample{}
+
+	for _, queue := range q.ListQueues() {
+		samples = append(samples, Sample{
+			Labels: Labels{
+				"time_control": queue.Name,
+				"variant":      queue.TimeControl.Variant,
+				"bots":         strconv.FormatBool(queue.Bots),
+			},
+			Value: float64(queue.Waiting),
+		})
+	}
+
+	metrics.Gauge("chess_queue_length", "Players waiting in each queue.", samples...)
+}
+
+// Empty the queue of the named catalog entry, letting its
+// players know, returns the players that were waiting
+func (q *QueueManager) Flush(name, variant string, bots bool) ([]*Player, error) {
+	q.mutex.Lock()
+
+	entry, ok := q.findNamed(name)
+	if !ok {
+		q.mutex.Unlock()
+		return nil, errors.New("Unknown queue")
+	}
+
+	if variant == Standard {
+		variant = ""
+	}
+
+	key := QueueKey{TimeControl: entry.TimeControl, Bots: bots}
+	key.TimeControl.Variant = variant
+
+	queue := q.queue[key]
+	delete(q.queue, key)
+
+	q.mutex.Unlock()
+
+	players := []*Player{}
+
+	if queue != nil {
+		for player := queue.Pop(); player != nil; player = queue.Pop() {
+			players = append(players, player)
+		}
+	}
+
+	for _, player := range players {
+		go notify(player, Response{
+			Type: QueueFlushed,
+			Text: "Queue flushed by a moderator",
+		})
+	}
+
+	return players, nil
+}
+
+// Stop taking players and empty the queues
+func (q *QueueManager) Drain(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.draining = true
+	q.queue = make(map[QueueKey]*Queue)
+
+	return nil
+}
+
+// Match the first players of the queue that may be paired
+func (q *QueueManager) Pair(queue *Queue, key QueueKey) {
+	players := queue.PopReady(MAX_PLAYERS)
+
+	if players != nil {
+		q.log().Info("Players paired",
+			"players", PlayerIds(players),
+			"time_control", key.TimeControl,
+			"bots", key.Bots,
+		)
+
+		q.bus.Publish(Message{
+			Type: MatchFound,
+			Payload: MatchParams{
+				Id:          uuid.New(),
+				Players:     players,
+				TimeControl: key.TimeControl,
+				Bots:        key.Bots,
+			},
+		})
 	}
+}
 
-	return queue, timeControl
+func (q *QueueManager) Topics() []MessageType {
+	return []MessageType{QueueUp, Dequeue, ListQueues, Disconnected}
 }
 
 func (q *QueueManager) Process(event Message) {
 	switch event.Type {
 	case QueueUp:
-		queue, timeControl := q.GetQueue(event)
+		queue, key, err := q.GetQueue(event)
+		if err != nil {
+			q.log().Info("Queue up rejected", "player_id", event.Player.Id, "error", err)
+			event.Player.Send(Response{
+				Type: Error,
+				Text: err.Error(),
+			})
+			return
+		}
+
 		queue.Push(event.Player)
 
+		q.log().Info("Player queued",
+			"player_id", event.Player.Id,
+			"time_control", key.TimeControl,
+			"bots", key.Bots,
+		)
+
 		event.Player.Send(Response{
 			Type: WaitForMatch,
 			Text: "Wait for match",
 		})
 
-		if queue.Length() == MAX_PLAYERS {
-			players := []*Player{}
-
-			for i := 0; i < MAX_PLAYERS; i++ {
-				players = append(players, queue.Pop())
-			}
-
-			Dispatcher <- Message{
-				Type: MatchFound,
-				Payload: MatchParams{
-					Players:     players,
-					TimeControl: timeControl,
-				},
-			}
+		// penalized players get another chance once they're
+		// allowed in, still behind whoever queued up earlier
+		if wait := time.Until(event.Player.PenalizedUntil()); wait > 0 {
+			time.AfterFunc(wait, func() {
+				q.Pair(queue, key)
+			})
 		}
+
+		q.Pair(queue, key)
+	case ListQueues:
+		event.Player.Send(Response{
+			Type:    QueueList,
+			Payload: q.ListQueues(),
+		})
 	case Dequeue, Disconnected:
-		for _, queue := range q.queue {
+		for _, queue := range q.Queues() {
 			queue.Remove(event.Player)
 		}
 	}
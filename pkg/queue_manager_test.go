@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,7 +10,8 @@ import (
 
 func TestReturnsResponse(t *testing.T) {
 	player := NewTestPlayer()
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
 
 	go queueManager.Process(Message{
 		Type:   QueueUp,
@@ -32,7 +34,8 @@ func TestReturnsResponse(t *testing.T) {
 
 func TestInvalidType(t *testing.T) {
 	player := NewTestPlayer()
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
 
 	go queueManager.Process(Message{
 		Type:   "something",
@@ -50,7 +53,8 @@ func TestAddsToQueue(t *testing.T) {
 	player1 := NewTestPlayer()
 	player2 := NewTestPlayer()
 
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
 
 	payload1 := map[string]interface{}{
 		"duration":  "1m",
@@ -81,14 +85,14 @@ func TestAddsToQueue(t *testing.T) {
 	var params1 TimeControl
 	mapstructure.Decode(payload1, &params1)
 
-	if queueManager.queue[params1].Length() != 1 {
+	if queueManager.queue[QueueKey{TimeControl: params1}].Length() != 1 {
 		t.Error("Expected 1 player on 1m+0s queue")
 	}
 
 	var params2 TimeControl
 	mapstructure.Decode(payload2, &params2)
 
-	if queueManager.queue[params2].Length() != 1 {
+	if queueManager.queue[QueueKey{TimeControl: params2}].Length() != 1 {
 		t.Error("Expected 1 player on 10m+0s queue")
 	}
 }
@@ -97,7 +101,8 @@ func TestCancel(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
 
 	payload1 := map[string]interface{}{
 		"duration":  "1m",
@@ -137,21 +142,22 @@ func TestCancel(t *testing.T) {
 	var params1 TimeControl
 	mapstructure.Decode(payload1, &params1)
 
-	if queue[params1].Length() != 0 {
-		t.Errorf("Expected empty queue, got %v", queue[params1].Length())
+	if queue[QueueKey{TimeControl: params1}].Length() != 0 {
+		t.Errorf("Expected empty queue, got %v", queue[QueueKey{TimeControl: params1}].Length())
 	}
 
 	var params2 TimeControl
 	mapstructure.Decode(payload2, &params2)
 
-	if queue[params2].Length() == 0 {
-		t.Errorf("Expected 1 player in queue, got %v", queue[params2].Length())
+	if queue[QueueKey{TimeControl: params2}].Length() == 0 {
+		t.Errorf("Expected 1 player in queue, got %v", queue[QueueKey{TimeControl: params2}].Length())
 	}
 }
 
 func TestDisconnectRemovesFromQueue(t *testing.T) {
 	player := NewTestPlayer()
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
 
 	payload := map[string]interface{}{
 		"duration":  "1m",
@@ -176,18 +182,64 @@ func TestDisconnectRemovesFromQueue(t *testing.T) {
 	var params TimeControl
 	mapstructure.Decode(payload, &params)
 
-	got := queueManager.queue[params].Pop()
+	got := queueManager.queue[QueueKey{TimeControl: params}].Pop()
 
 	if got != nil {
 		t.Errorf("Expected empty queue, got %v", got)
 	}
 }
 
+func TestDequeueWhileQueuesChange(t *testing.T) {
+	queueManager := NewQueueManager(NewBus())
+
+	player := NewTestPlayer()
+	other := NewTestPlayer()
+
+	done := make(chan bool)
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-other.Outgoing:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	queued := wait(func() {
+		for _, entry := range DefaultCatalog {
+			queueManager.Process(Message{
+				Type:   QueueUp,
+				Player: other,
+				Payload: map[string]interface{}{
+					"duration":  entry.Duration,
+					"increment": entry.Increment,
+				},
+			})
+		}
+
+		queueManager.Drain(context.Background())
+	})
+
+	for i := 0; i < 50; i++ {
+		queueManager.Process(Message{
+			Type:   Dequeue,
+			Player: player,
+		})
+	}
+
+	<-queued
+}
+
 func TestDispatchesMatchFound(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	events := bus.Listen()
+	queueManager := NewQueueManager(bus)
 
 	payload := map[string]interface{}{
 		"duration":  "1m",
@@ -225,7 +277,7 @@ func TestDispatchesMatchFound(t *testing.T) {
 	}
 
 	select {
-	case res := <-Dispatcher:
+	case res := <-events:
 		if res.Type != MatchFound {
 			t.Errorf("Expected match found, got %+v", res)
 		}
@@ -248,8 +300,8 @@ func TestDispatchesMatchFound(t *testing.T) {
 	var params TimeControl
 	mapstructure.Decode(payload, &params)
 
-	if queueManager.queue[params].Length() != 0 {
-		t.Errorf("Expected empty queue, got %v", queueManager.queue[params].Length())
+	if queueManager.queue[QueueKey{TimeControl: params}].Length() != 0 {
+		t.Errorf("Expected empty queue, got %v", queueManager.queue[QueueKey{TimeControl: params}].Length())
 	}
 }
 
@@ -257,7 +309,9 @@ func TestDoesNotDispatchMatchFound(t *testing.T) {
 	p1 := NewTestPlayer()
 	p2 := NewTestPlayer()
 
-	queueManager := NewQueueManager()
+	bus := NewBus()
+	events := bus.Listen()
+	queueManager := NewQueueManager(bus)
 
 	go queueManager.Process(Message{
 		Type:   QueueUp,
@@ -297,9 +351,273 @@ func TestDoesNotDispatchMatchFound(t *testing.T) {
 
 	select {
 	case <-time.After(time.Second):
-	case res := <-Dispatcher:
+	case res := <-events:
 		if res.Type == MatchFound {
 			t.Error("Should not receive match found")
 		}
 	}
 }
+
+func TestRejectsUnknownVariant(t *testing.T) {
+	player := NewTestPlayer()
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
+
+	go queueManager.Process(Message{
+		Type:   QueueUp,
+		Player: player,
+		Payload: map[string]interface{}{
+			"duration":  "1m",
+			"increment": "0s",
+			"variant":   "bughouse",
+		},
+	})
+
+	select {
+	case res := <-player.Outgoing:
+		if res.Type != Error {
+			t.Errorf("Expected error, got %+v", res)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Error("Timeout before server response")
+	}
+}
+
+func TestKeepsBotsOutOfHumanQueues(t *testing.T) {
+	human := NewTestPlayer()
+	bot := NewTestPlayer()
+	bot.Bot = true
+
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
+
+	payload := map[string]interface{}{
+		"duration":  "1m",
+		"increment": "0s",
+	}
+
+	for _, player := range []*Player{human, bot} {
+		go queueManager.Process(Message{
+			Type:    QueueUp,
+			Player:  player,
+			Payload: payload,
+		})
+		<-player.Outgoing
+	}
+
+	var params TimeControl
+	mapstructure.Decode(payload, &params)
+
+	if queueManager.queue[QueueKey{TimeControl: params}].Length() != 1 {
+		t.Error("Expected only the human in the human queue")
+	}
+	if queueManager.queue[QueueKey{TimeControl: params, Bots: true}].Length() != 1 {
+		t.Error("Expected bot in the bot queue")
+	}
+}
+
+func TestHumanOptsIntoBotQueue(t *testing.T) {
+	human := NewTestPlayer()
+	bot := NewTestPlayer()
+	bot.Bot = true
+
+	bus := NewBus()
+	events := bus.Listen()
+	queueManager := NewQueueManager(bus)
+
+	go queueManager.Process(Message{
+		Type:   QueueUp,
+		Player: bot,
+		Payload: map[string]interface{}{
+			"duration":  "1m",
+			"increment": "0s",
+		},
+	})
+	<-bot.Outgoing
+
+	go queueManager.Process(Message{
+		Type:   QueueUp,
+		Player: human,
+		Payload: map[string]interface{}{
+			"duration":  "1m",
+			"increment": "0s",
+			"bots":      true,
+		},
+	})
+	<-human.Outgoing
+
+	select {
+	case res := <-events:
+		params := res.Payload.(MatchParams)
+		if res.Type != MatchFound || !params.Bots {
+			t.Errorf("Expected match from the bot queue, got %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected match found, got timeout")
+	}
+}
+
+func TestPenalizedPlayersWait(t *testing.T) {
+	p1 := NewTestPlayer()
+	p2 := NewTestPlayer()
+	p3 := NewTestPlayer()
+	p4 := NewTestPlayer()
+
+	p1.Penalize(200 * time.Millisecond)
+
+	bus := NewBus()
+	events := bus.Listen()
+	queueManager := NewQueueManager(bus)
+
+	payload := map[string]interface{}{
+		"duration":  "3m",
+		"increment": "0s",
+	}
+
+	for _, player := range []*Player{p1, p2} {
+		go queueManager.Process(Message{
+			Type:    QueueUp,
+			Player:  player,
+			Payload: payload,
+		})
+		<-player.Outgoing
+	}
+
+	select {
+	case res := <-events:
+		t.Fatalf("Expected penalized player to wait, got %+v", res)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	go queueManager.Process(Message{
+		Type:    QueueUp,
+		Player:  p3,
+		Payload: payload,
+	})
+	<-p3.Outgoing
+
+	select {
+	case res := <-events:
+		players := res.Payload.(MatchParams).Players
+		if players[0] != p2 || players[1] != p3 {
+			t.Error("Expected players queued after the penalized one to go first")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected match found")
+	}
+
+	go queueManager.Process(Message{
+		Type:    QueueUp,
+		Player:  p4,
+		Payload: payload,
+	})
+	<-p4.Outgoing
+
+	select {
+	case res := <-events:
+		players := res.Payload.(MatchParams).Players
+		if players[0] != p1 || players[1] != p4 {
+			t.Error("Expected penalized player to be paired once allowed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected match found once the penalty ran out")
+	}
+}
+
+func TestDrainingRejectsPlayers(t *testing.T) {
+	player := NewTestPlayer()
+
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
+	queueManager.Drain(context.Background())
+
+	go queueManager.Process(Message{
+		Type:   QueueUp,
+		Player: player,
+		Payload: map[string]interface{}{
+			"duration": "1m",
+		},
+	})
+
+	if res := <-player.Outgoing; res.Type != Error {
+		t.Errorf("Expected error, got %v", res.Type)
+	}
+}
+
+func TestOnlyAllowedTimeControls(t *testing.T) {
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
+	queueManager.SetCatalog([]CatalogEntry{
+		{"5+3 Blitz", TimeControl{Duration: "5m", Increment: "3s"}},
+	})
+
+	for _, test := range []struct {
+		payload  map[string]interface{}
+		expected ResponseType
+	}{
+		{map[string]interface{}{"duration": "7m", "increment": "3s"}, Error},
+		{map[string]interface{}{"duration": "5m", "increment": "3s"}, WaitForMatch},
+		{map[string]interface{}{"duration": "300s", "increment": "3s"}, WaitForMatch},
+		{map[string]interface{}{"queue": "5+3 Blitz"}, WaitForMatch},
+		{map[string]interface{}{"queue": "3+2 Blitz"}, Error},
+	} {
+		player := NewTestPlayer()
+
+		go queueManager.Process(Message{
+			Type:    QueueUp,
+			Player:  player,
+			Payload: test.payload,
+		})
+
+		if res := <-player.Outgoing; res.Type != test.expected {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.payload, res.Type)
+		}
+	}
+}
+
+func TestListQueues(t *testing.T) {
+	player := NewTestPlayer()
+
+	bus := NewBus()
+	queueManager := NewQueueManager(bus)
+
+	for _, payload := range []map[string]interface{}{
+		{"queue": "3+2 Blitz"},
+		{"duration": "1m", "increment": "0s", "variant": Chess960},
+	} {
+		waiting := NewTestPlayer()
+
+		go queueManager.Process(Message{
+			Type:    QueueUp,
+			Player:  waiting,
+			Payload: payload,
+		})
+		<-waiting.Outgoing
+	}
+
+	go queueManager.Process(Message{
+		Type:   ListQueues,
+		Player: player,
+	})
+
+	res := <-player.Outgoing
+	if res.Type != QueueList {
+		t.Fatalf("Expected queue list, got %v", res.Type)
+	}
+
+	queues := res.Payload.([]QueueInfo)
+	if len(queues) != len(DefaultCatalog)+1 {
+		t.Fatalf("Expected the catalog and the variant queue, got %+v", queues)
+	}
+
+	for _, queue := range queues {
+		expected := 0
+		if queue.Name == "3+2 Blitz" || queue.Name == "1+0 Bullet "+Chess960 {
+			expected = 1
+		}
+
+		if queue.Waiting != expected {
+			t.Errorf("Expected %v waiting in %v, got %v", expected, queue.Name, queue.Waiting)
+		}
+	}
+}
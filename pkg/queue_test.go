@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -8,6 +9,9 @@ func NewTestPlayer() *Player {
 	return &Player{
 		Incoming: make(chan Message),
 		Outgoing: make(chan Response),
+
+		colors: []Color{},
+		mutex:  new(sync.Mutex),
 	}
 }
 
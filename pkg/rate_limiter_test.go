@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := NewRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow() {
+			t.Errorf("Expected token %v to be allowed", i)
+		}
+	}
+
+	if limiter.Allow() {
+		t.Error("Expected bucket to be empty")
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := NewRateLimiter(20, 1)
+
+	if !limiter.Allow() {
+		t.Error("Expected first token to be allowed")
+	}
+	if limiter.Allow() {
+		t.Error("Expected bucket to be empty")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !limiter.Allow() {
+		t.Error("Expected bucket to refill")
+	}
+}
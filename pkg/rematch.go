@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Time players have to agree on a rematch after game over
+const REMATCH_TIMEOUT = 30 * time.Second
+
+type Rematch struct {
+	GameId      uuid.UUID
+	Players     []*Player
+	TimeControl TimeControl
+
+	mutex     *sync.Mutex
+	requested map[*Player]bool
+}
+
+// Rematch of a finished game, players are white and black
+func NewRematch(gameId uuid.UUID, players []*Player, timeControl TimeControl) *Rematch {
+	return &Rematch{
+		GameId:      gameId,
+		Players:     players,
+		TimeControl: timeControl,
+
+		mutex:     new(sync.Mutex),
+		requested: make(map[*Player]bool),
+	}
+}
+
+func (r *Rematch) HasPlayer(player *Player) bool {
+	for _, p := range r.Players {
+		if p == player {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rematch) Opponent(player *Player) *Player {
+	if r.Players[0] == player {
+		return r.Players[1]
+	}
+	return r.Players[0]
+}
+
+// Register player's request, returns true once both agreed
+func (r *Rematch) Request(player *Player) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requested[player] = true
+
+	return len(r.requested) == len(r.Players)
+}
+
+func (r *Rematch) Requested() []*Player {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	players := []*Player{}
+	for player := range r.requested {
+		players = append(players, player)
+	}
+
+	return players
+}
+
+// Players with colors swapped, white first
+func (r *Rematch) Colors() []*Player {
+	return []*Player{r.Players[1], r.Players[0]}
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type deadline struct {
+	gameId uuid.UUID
+	at     time.Time
+}
+
+type deadlineHeap []deadline
+
+func (h deadlineHeap) Len() int            { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h deadlineHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *deadlineHeap) Push(x interface{}) { *h = append(*h, x.(deadline)) }
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// DeadlineScheduler calls expire once a game's deadline passes, keeping
+// a single timer for the earliest deadline however many games there are
+type DeadlineScheduler struct {
+	mutex     *sync.Mutex
+	deadlines map[uuid.UUID]time.Time
+	queue     *deadlineHeap
+	timer     *time.Timer
+	expire    func(gameId uuid.UUID)
+	done      chan bool
+}
+
+func NewDeadlineScheduler(expire func(gameId uuid.UUID)) *DeadlineScheduler {
+	scheduler := &DeadlineScheduler{
+		mutex:     new(sync.Mutex),
+		deadlines: make(map[uuid.UUID]time.Time),
+		queue:     &deadlineHeap{},
+		timer:     time.NewTimer(time.Hour),
+		expire:    expire,
+		done:      make(chan bool),
+	}
+	scheduler.timer.Stop()
+
+	go scheduler.run()
+
+	return scheduler
+}
+
+// Set or move the game's deadline
+func (s *DeadlineScheduler) Schedule(gameId uuid.UUID, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deadlines[gameId] = at
+	heap.Push(s.queue, deadline{gameId: gameId, at: at})
+
+	s.reset()
+}
+
+// Outdated entries stay in the queue and are skipped when they come up
+func (s *DeadlineScheduler) Cancel(gameId uuid.UUID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.deadlines, gameId)
+}
+
+func (s *DeadlineScheduler) Stop() {
+	close(s.done)
+}
+
+func (s *DeadlineScheduler) run() {
+	for {
+		select {
+		case <-s.done:
+			s.timer.Stop()
+			return
+		case <-s.timer.C:
+			for _, gameId := range s.due() {
+				s.expire(gameId)
+			}
+		}
+	}
+}
+
+// Pop the games whose deadline passed
+func (s *DeadlineScheduler) due() []uuid.UUID {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	expired := []uuid.UUID{}
+
+	for s.queue.Len() > 0 && !(*s.queue)[0].at.After(now) {
+		next := heap.Pop(s.queue).(deadline)
+
+		if at, ok := s.deadlines[next.gameId]; ok && at.Equal(next.at) {
+			delete(s.deadlines, next.gameId)
+			expired = append(expired, next.gameId)
+		}
+	}
+
+	s.reset()
+
+	return expired
+}
+
+// Wake up for the earliest deadline
+func (s *DeadlineScheduler) reset() {
+	s.timer.Stop()
+
+	if s.queue.Len() > 0 {
+		s.timer.Reset(time.Until((*s.queue)[0].at))
+	}
+}
@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSchedulerFiresInOrder(t *testing.T) {
+	expired := make(chan uuid.UUID, 3)
+
+	scheduler := NewDeadlineScheduler(func(gameId uuid.UUID) {
+		expired <- gameId
+	})
+	defer scheduler.Stop()
+
+	first, second := uuid.New(), uuid.New()
+
+	scheduler.Schedule(second, time.Now().Add(60*time.Millisecond))
+	scheduler.Schedule(first, time.Now().Add(20*time.Millisecond))
+
+	for _, want := range []uuid.UUID{first, second} {
+		select {
+		case got := <-expired:
+			if got != want {
+				t.Errorf("Expected %v to expire, got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected deadline to expire")
+		}
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	expired := make(chan uuid.UUID, 2)
+
+	scheduler := NewDeadlineScheduler(func(gameId uuid.UUID) {
+		expired <- gameId
+	})
+	defer scheduler.Stop()
+
+	moved, canceled := uuid.New(), uuid.New()
+
+	scheduler.Schedule(moved, time.Now().Add(20*time.Millisecond))
+	scheduler.Schedule(moved, time.Now().Add(time.Hour))
+
+	scheduler.Schedule(canceled, time.Now().Add(20*time.Millisecond))
+	scheduler.Cancel(canceled)
+
+	select {
+	case gameId := <-expired:
+		t.Errorf("Expected no deadline to expire, got %v", gameId)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
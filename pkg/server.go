@@ -2,92 +2,806 @@ package pkg
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var Dispatcher chan Message = make(chan Message)
+// How long closed connections get to say goodbye on shutdown
+const CLOSE_TIMEOUT = 2 * time.Second
 
-type Handler interface {
-	Process(event Message)
+// Defaults of the limits connections are held to
+const (
+	MESSAGE_RATE             = 10
+	MESSAGE_BURST            = 20
+	ADDR_MESSAGE_RATE        = 30
+	ADDR_MESSAGE_BURST       = 60
+	MAX_CONNECTIONS_PER_ADDR = 10
+	MAX_MESSAGE_SIZE         = 4096
+	MAX_VIOLATIONS           = 10
+)
+
+// Set when building, e.g. -ldflags "-X example.com/chess-server/pkg.Version=1.2.0"
+var Version = "dev"
+
+// Endpoint is implemented by handlers that expose HTTP routes
+type Endpoint interface {
+	Routes() map[string]http.HandlerFunc
+}
+
+// Checker is implemented by handlers and stores that may be unable
+// to do their job, the server isn't ready while one fails
+type Checker interface {
+	Check() error
+}
+
+// Drainer is implemented by handlers with work to wrap up on
+// shutdown, they should give up on it once ctx is done
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// Keeps a player out, along with the address they played from
+type Ban struct {
+	PlayerId uuid.UUID `json:"player_id"`
+	Addr     string    `json:"addr,omitempty"`
+	Until    time.Time `json:"until"`
+	Reason   string    `json:"reason"`
+}
+
+// How long an address's limits outlive its last connection, so
+// reconnecting doesn't start them over
+const ADDR_COOLDOWN = time.Minute
+
+// Connections open from an address, the messages they share and
+// the times they went over their limits
+type address struct {
+	connections int
+	limiter     *RateLimiter
+	strikes     *RateLimiter
+	idle        time.Time
 }
 
 type Server struct {
-	closed   chan bool
-	reading  chan bool
-	server   *http.Server
-	handlers []Handler
+	bus       *Bus
+	server    *http.Server
+	handlers  []Handler
+	endpoints []Endpoint
+	accounts  *Accounts
+	origins   []string
+	players   map[*Player]bool
+	online    map[uuid.UUID]bool
+	bans      map[uuid.UUID]Ban
+	addrs     map[string]*address
+	draining  bool
+	logger    *Logger
+	mutex     *sync.Mutex
+
+	messageLimit RateLimit
+	addrLimit    RateLimit
+	connections  ConnectionLimits
+	proxies      []*net.IPNet
 }
 
-func NewServer(handlers []Handler) *Server {
+// Handlers are subscribed to bus, which they share with the server
+func NewServer(bus *Bus, handlers []Handler) *Server {
+	for _, handler := range handlers {
+		bus.Register(handler)
+	}
+
 	return &Server{
+		bus:      bus,
 		handlers: handlers,
 		server:   &http.Server{},
-		closed:   make(chan bool),
+		accounts: NewAccounts(),
+		players:  make(map[*Player]bool),
+		online:   make(map[uuid.UUID]bool),
+		bans:     make(map[uuid.UUID]Ban),
+		addrs:    make(map[string]*address),
+		mutex:    new(sync.Mutex),
+
+		messageLimit: RateLimit{Rate: MESSAGE_RATE, Burst: MESSAGE_BURST},
+		addrLimit:    RateLimit{Rate: ADDR_MESSAGE_RATE, Burst: ADDR_MESSAGE_BURST},
+		connections: ConnectionLimits{
+			PerAddr:     MAX_CONNECTIONS_PER_ADDR,
+			MessageSize: MAX_MESSAGE_SIZE,
+			Violations:  MAX_VIOLATIONS,
+		},
+	}
+}
+
+// How fast each connection, and all connections from an address
+// together, may send messages
+func (s *Server) SetMessageLimits(perConnection, perAddr RateLimit) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messageLimit = perConnection
+	s.addrLimit = perAddr
+}
+
+// Trusted proxies that aren't addresses or networks are left out,
+// Config.Validate reports them
+func (s *Server) SetConnectionLimits(limits ConnectionLimits) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.connections = limits
+	s.proxies = nil
+
+	for _, proxy := range limits.TrustedProxies {
+		if networks, err := ParseNetworks([]string{proxy}); err == nil {
+			s.proxies = append(s.proxies, networks...)
+		}
+	}
+}
+
+// Address r comes from, behind trusted proxies that's the last
+// one in X-Forwarded-For they didn't add themselves
+func (s *Server) clientAddr(r *http.Request) string {
+	s.mutex.Lock()
+	proxies := s.proxies
+	s.mutex.Unlock()
+
+	addr := remoteIP(r.RemoteAddr)
+	if !inNetworks(addr, proxies) {
+		return addr
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		addr = hop
+		if !inNetworks(hop, proxies) {
+			break
+		}
 	}
+
+	return addr
 }
 
-func (s *Server) Shutdown() {
-	s.server.Shutdown(context.Background())
+// Parse addresses and CIDR networks, an address is a network
+// of its own
+func ParseNetworks(addrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+
+		if strings.Contains(addr, "/") {
+			_, network, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", addr)
+		}
+
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return networks, nil
+}
+
+func inNetworks(addr string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (s *Server) Listen(addr string) {
+// Count a connection from addr, returns the limits it shares with
+// the address or an error if it has too many already
+func (s *Server) admit(addr string) (*address, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, a := range s.addrs {
+		if a.connections == 0 && time.Since(a.idle) > ADDR_COOLDOWN {
+			delete(s.addrs, key)
+		}
+	}
+
+	a, ok := s.addrs[addr]
+	if !ok {
+		// violations allowed in a minute before connections are
+		// closed, whatever they send after that is dropped
+		violations := s.connections.Violations
+
+		a = &address{
+			limiter: NewRateLimiter(s.addrLimit.Rate, s.addrLimit.Burst),
+			strikes: NewRateLimiter(float64(violations)/60, violations),
+		}
+		s.addrs[addr] = a
+	}
+
+	if s.connections.PerAddr > 0 && a.connections >= s.connections.PerAddr {
+		return nil, errors.New("Too many connections")
+	}
+
+	a.connections++
+
+	return a, nil
+}
+
+func (s *Server) release(addr string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// kept until ADDR_COOLDOWN passed, see admit
+	if a, ok := s.addrs[addr]; ok {
+		a.connections--
+
+		if a.connections <= 0 {
+			a.idle = time.Now()
+		}
+	}
+}
+
+// Hold account for a connection, false if another one has it.
+// Games, challenges and the admin API find players by id, which a
+// second connection on the same account would share
+func (s *Server) reserve(account *BotAccount) bool {
+	if account == nil {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.online[account.Id] {
+		return false
+	}
+
+	s.online[account.Id] = true
+
+	return true
+}
+
+func (s *Server) unreserve(account *BotAccount) {
+	if account == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.online, account.Id)
+}
+
+// Serve the routes of endpoint besides the handlers' own
+func (s *Server) Handle(endpoint Endpoint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.endpoints = append(s.endpoints, endpoint)
+}
+
+func (s *Server) SetLogger(logger *Logger) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.logger = logger
+}
+
+func (s *Server) Bus() *Bus {
+	return s.bus
+}
+
+// Bot accounts allowed to connect with a token
+func (s *Server) Accounts() *Accounts {
+	return s.accounts
+}
+
+// Stop taking players, warn them the server goes down once ctx
+// is done, let handlers wrap up by then and close every socket.
+// Probes keep being answered, with /readyz failing, until then.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.draining = true
+	logger := s.logger
+	s.mutex.Unlock()
+
+	logger.Info("Shutting down", "players", len(s.Players()))
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now()
+	}
+
+	notified := new(sync.WaitGroup)
+
+	for _, player := range s.Players() {
+		notified.Add(1)
+
+		go func(player *Player) {
+			defer notified.Done()
+
+			sent := notify(player, Response{
+				Type:    ServerShutdown,
+				Payload: ShutdownNotice{Deadline: deadline},
+			})
+
+			if !sent {
+				logger.Debug("Shutdown notice dropped", "player_id", player.Id)
+			}
+		}(player)
+	}
+
+	// handlers drain side by side, so none starts games while
+	// another waits for its own to finish
+	drained := new(sync.WaitGroup)
+	errs := make(chan error, len(s.handlers))
+
+	for _, handler := range s.handlers {
+		if drainer, ok := handler.(Drainer); ok {
+			drained.Add(1)
+
+			go func(drainer Drainer) {
+				defer drained.Done()
+
+				if drainErr := drainer.Drain(ctx); drainErr != nil {
+					logger.Error("Drain failed", "error", drainErr)
+					errs <- drainErr
+				}
+			}(drainer)
+		}
+	}
+
+	drained.Wait()
+	close(errs)
+
+	// the first failure, if any
+	err := <-errs
+
+	// don't wait on players who stopped reading
+	sent := make(chan bool)
+	go func() {
+		notified.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(CLOSE_TIMEOUT):
+	}
+
+	for _, player := range s.Players() {
+		player.Disconnect(websocket.CloseGoingAway, "Server shutting down")
+	}
+
+	// players are gone once their disconnect went out
+	timeout := time.After(CLOSE_TIMEOUT)
+	for len(s.Players()) > 0 {
+		select {
+		case <-timeout:
+			logger.Warn("Players still connected", "players", len(s.Players()))
+			return s.close(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	return s.close(err)
+}
+
+// Stop serving HTTP, keeping the first error of the shutdown
+func (s *Server) close(err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), CLOSE_TIMEOUT)
+	defer cancel()
+
+	if closeErr := s.server.Shutdown(ctx); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (s *Server) Players() []*Player {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	players := make([]*Player, 0, len(s.players))
+	for player := range s.players {
+		players = append(players, player)
+	}
+
+	return players
+}
+
+func (s *Server) FindPlayer(playerId uuid.UUID) *Player {
+	for _, player := range s.Players() {
+		if player.Id == playerId {
+			return player
+		}
+	}
+
+	return nil
+}
+
+// Send text to every connected player
+func (s *Server) Announce(text string) {
+	for _, player := range s.Players() {
+		go notify(player, Response{
+			Type: Announcement,
+			Text: text,
+		})
+	}
+}
+
+// Keep the player out for d, disconnecting them if they're
+// connected, and whoever connects from where they played. Guests
+// get a new id each connection so only they and bot accounts,
+// which keep theirs, can be banned.
+func (s *Server) Ban(playerId uuid.UUID, d time.Duration, reason string) (Ban, error) {
+	ban := Ban{
+		PlayerId: playerId,
+		Until:    time.Now().Add(d),
+		Reason:   reason,
+	}
+
+	player := s.FindPlayer(playerId)
+	if player != nil {
+		ban.Addr = player.Addr()
+	} else if s.accounts.Find(playerId) == nil {
+		return Ban{}, errors.New("Player not connected")
+	}
+
+	s.mutex.Lock()
+	s.bans[playerId] = ban
+	s.mutex.Unlock()
+
+	if player != nil {
+		player.Disconnect(websocket.ClosePolicyViolation, "Banned")
+	}
+
+	return ban, nil
+}
+
+// Lift the player's ban, returns false if they weren't banned
+func (s *Server) Unban(playerId uuid.UUID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.bans[playerId]
+	delete(s.bans, playerId)
+
+	return ok
+}
+
+// Bans still running, forgetting those that ran out
+func (s *Server) Bans() []Ban {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bans := []Ban{}
+
+	for playerId, ban := range s.bans {
+		if time.Now().After(ban.Until) {
+			delete(s.bans, playerId)
+			continue
+		}
+
+		bans = append(bans, ban)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+
+	return bans
+}
+
+// Whether connections from addr or for account are banned
+func (s *Server) IsBanned(addr string, account *BotAccount) bool {
+	for _, ban := range s.Bans() {
+		if ban.Addr != "" && ban.Addr == addr {
+			return true
+		}
+		if account != nil && ban.PlayerId == account.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Players may be closing as they're warned, which panics,
+// returns whether response was sent
+func notify(player *Player, response Response) (sent bool) {
+	defer func() {
+		if recover() != nil {
+			sent = false
+		}
+	}()
+
+	player.Send(response)
+
+	return true
+}
+
+// Only accept connections from pages served by origins,
+// any page may connect when there are none
+func (s *Server) SetOrigins(origins []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.origins = origins
+}
+
+func (s *Server) CheckOrigin(r *http.Request) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.origins) == 0 {
+		return true
+	}
+
+	for _, origin := range s.origins {
+		if r.Header.Get("Origin") == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) Listen(addr string) error {
+	return s.listen(addr, func() error {
+		return s.server.ListenAndServe()
+	})
+}
+
+func (s *Server) ListenTLS(addr, certFile, keyFile string) error {
+	return s.listen(addr, func() error {
+		return s.server.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+func (s *Server) listen(addr string, serve func() error) error {
+	mux := http.NewServeMux()
+
+	s.mutex.Lock()
+	endpoints := append([]Endpoint{}, s.endpoints...)
+	s.mutex.Unlock()
+
+	for _, handler := range s.handlers {
+		if endpoint, ok := handler.(Endpoint); ok {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		for pattern, route := range endpoint.Routes() {
+			mux.HandleFunc(pattern, route)
+		}
+	}
+
+	mux.HandleFunc("/ws", s.HandleRequest)
+	mux.HandleFunc("/healthz", s.ServeHealth)
+	mux.HandleFunc("/readyz", s.ServeReady)
+	mux.HandleFunc("/version", s.ServeVersion)
+	mux.HandleFunc("/metrics", s.ServeMetrics)
+
 	s.server.Addr = addr
-	s.server.Handler = http.HandlerFunc(s.HandleRequest)
-	err := s.server.ListenAndServe()
+	s.server.Handler = mux
+
+	if err := serve(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// The process is up and serving
+func (s *Server) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// Players may be sent here, which they may not while shutting
+// down or when a handler fails its check
+func (s *Server) ServeReady(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	draining := s.draining
+	s.mutex.Unlock()
+
+	if draining {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
 
-	if err == http.ErrServerClosed {
-		s.closed <- true
-		s.reading <- false
+	for _, handler := range s.handlers {
+		if checker, ok := handler.(Checker); ok {
+			if err := checker.Check(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+func (s *Server) ServeVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(VersionResponse{
+		Version: Version,
+		Go:      runtime.Version(),
+	})
+}
+
+// Metrics of the server and of the handlers that collect some
+func (s *Server) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := NewMetricsWriter(w)
+	metrics.Gauge("chess_connected_players", "Players connected over websockets.", Sample{Value: float64(len(s.Players()))})
+	s.bus.Collect(metrics)
+
+	for _, handler := range s.handlers {
+		if collector, ok := handler.(Collector); ok {
+			collector.Collect(metrics)
+		}
 	}
 }
 
 func (s *Server) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	draining := s.draining
+	logger := s.logger.With("remote", r.RemoteAddr)
+	s.mutex.Unlock()
+
+	account, err := s.accounts.FromRequest(r)
+	if err != nil {
+		logger.Warn("Unauthorized connection", "error", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if draining {
+		logger.Debug("Connection refused while shutting down")
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	addr := s.clientAddr(r)
+
+	if s.IsBanned(addr, account) {
+		logger.Info("Banned connection refused")
+		http.Error(w, "Banned", http.StatusForbidden)
+		return
+	}
+
+	if !s.reserve(account) {
+		logger.Info("Account already connected", "account", account.Name)
+		http.Error(w, "Account already connected", http.StatusConflict)
+		return
+	}
+
+	shared, err := s.admit(addr)
+	if err != nil {
+		s.unreserve(account)
+		logger.Warn("Connection refused", "error", err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin: s.CheckOrigin,
 	}
 	socket, err := upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
+		s.unreserve(account)
+		s.release(addr)
+		logger.Warn("Upgrade failed", "error", err)
 		return
 	}
 
-	player := NewPlayer(socket)
+	s.mutex.Lock()
+	messageLimit := s.messageLimit
+	limits := s.connections
+	s.mutex.Unlock()
+
+	socket.SetReadLimit(limits.MessageSize)
+
+	player := NewPlayer(socket, addr, account, logger)
+	player.logger.Info("Player connected", "bot", player.Bot)
+
+	s.mutex.Lock()
+	s.players[player] = true
+	s.mutex.Unlock()
 
 	go func() {
-		for {
-			select {
-			case <-s.reading:
-				return
-			case message, ok := <-player.Incoming:
-				message.Player = player
+		s.bus.Publish(Message{
+			Type:   Connected,
+			Player: player,
+		})
+
+		limiter := NewRateLimiter(messageLimit.Rate, messageLimit.Burst)
+		kicked := false
 
-				if !ok { // disconnected
-					break
+		// closed after the disconnected message
+		for message := range player.Incoming {
+			message.Player = player
+
+			if message.Type != Disconnected {
+				if kicked {
+					continue
 				}
 
-				Dispatcher <- message
-			}
-		}
-	}()
+				// answering in order holds back nobody but the
+				// player going over their limits
+				if !limiter.Allow() || !shared.limiter.Allow() {
+					if shared.strikes.Allow() {
+						notify(player, Response{
+							Type: Error,
+							Text: "Too many messages",
+						})
+					} else {
+						kicked = true
+						player.logger.Warn("Player flooding, disconnecting", "type", message.Type)
+						player.Disconnect(websocket.ClosePolicyViolation, "Too many messages")
+					}
 
-	go func() {
-		for {
-			select {
-			case <-s.closed:
-				return
-			case event, ok := <-Dispatcher:
-				if !ok {
-					break
+					continue
 				}
 
-				for _, handler := range s.handlers {
-					go handler.Process(event)
+				// internal messages would reach handlers with
+				// payloads they trust
+				if !ClientMessages[message.Type] {
+					player.logger.Debug("Dropped message", "type", message.Type)
+					notify(player, Response{
+						Type: Error,
+						Text: "Unknown message type",
+					})
+					continue
 				}
 			}
+
+			s.bus.Publish(message)
 		}
+
+		s.mutex.Lock()
+		delete(s.players, player)
+		s.mutex.Unlock()
+
+		s.unreserve(account)
+		s.release(addr)
+
+		player.logger.Info("Player disconnected")
 	}()
 }
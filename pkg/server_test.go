@@ -1,6 +1,13 @@
 package pkg
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,7 +35,7 @@ func TestHandlers(t *testing.T) {
 	server := StartServer([]Handler{
 		testHandler,
 	})
-	defer server.Shutdown()
+	defer server.Shutdown(context.Background())
 
 	client, _ := NewClient()
 	client.Send(QueueUp)
@@ -53,7 +60,7 @@ func TestClientDisconnect(t *testing.T) {
 		testHandler,
 	})
 
-	defer server.Shutdown()
+	defer server.Shutdown(context.Background())
 
 	client, _ := NewClient()
 	client.Close()
@@ -79,3 +86,176 @@ func assertPanic(t *testing.T, f func()) {
 
 	f()
 }
+
+func TestShutdownNotifiesPlayers(t *testing.T) {
+	server := StartServer([]Handler{})
+
+	client, _ := NewClient()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- server.Shutdown(ctx)
+	}()
+
+	select {
+	case res := <-client.Incoming:
+		if res.Type != ServerShutdown {
+			t.Errorf("Expected server shutdown, got %v", res.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown notice, got timeout")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown to finish")
+	}
+
+	if players := server.Players(); len(players) != 0 {
+		t.Errorf("Expected every player to be disconnected, got %v", len(players))
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	server := NewServer(NewBus(), []Handler{})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Origin", "https://evil.example")
+
+	if !server.CheckOrigin(request) {
+		t.Error("Expected any origin without a list")
+	}
+
+	server.SetOrigins([]string{"https://chess.example"})
+
+	if server.CheckOrigin(request) {
+		t.Error("Expected unknown origin to be refused")
+	}
+
+	request.Header.Set("Origin", "https://chess.example")
+
+	if !server.CheckOrigin(request) {
+		t.Error("Expected listed origin to be accepted")
+	}
+}
+
+func TestClientAddrBehindProxies(t *testing.T) {
+	server := NewServer(NewBus(), []Handler{})
+
+	request := httptest.NewRequest("GET", "/ws", nil)
+	request.RemoteAddr = "10.0.0.2:4321"
+	request.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9")
+
+	if addr := server.clientAddr(request); addr != "10.0.0.2" {
+		t.Errorf("Expected the forwarded header to be ignored, got %v", addr)
+	}
+
+	server.SetConnectionLimits(ConnectionLimits{
+		PerAddr:        MAX_CONNECTIONS_PER_ADDR,
+		MessageSize:    MAX_MESSAGE_SIZE,
+		Violations:     MAX_VIOLATIONS,
+		TrustedProxies: []string{"10.0.0.0/8", "203.0.113.9"},
+	})
+
+	// the leftmost entry is whatever the client claims
+	if addr := server.clientAddr(request); addr != "198.51.100.7" {
+		t.Errorf("Expected the client behind both proxies, got %v", addr)
+	}
+
+	request.RemoteAddr = "192.0.2.1:4321"
+
+	if addr := server.clientAddr(request); addr != "192.0.2.1" {
+		t.Errorf("Expected untrusted peers not to be forwarded for, got %v", addr)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	player := NewTestPlayer()
+
+	bus := NewBus()
+	queues := NewQueueManager(bus)
+	server := NewServer(bus, []Handler{queues, NewMatchMaker(bus, time.Second), NewGameManager(bus)})
+
+	go queues.Process(Message{
+		Type:    QueueUp,
+		Player:  player,
+		Payload: map[string]interface{}{"queue": "3+2 Blitz"},
+	})
+	<-player.Outgoing
+
+	recorder := httptest.NewRecorder()
+	server.ServeMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		"chess_connected_players 0\n",
+		`chess_queue_length{bots="false",time_control="3+2 Blitz",variant=""} 1` + "\n",
+		"chess_pending_matches 0\n",
+		"chess_live_games 0\n",
+		"# TYPE chess_move_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in metrics, got\n%s", expected, body)
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "games")
+	store, _ := NewFileStore(dir)
+
+	bus := NewBus()
+	games := NewGameManager(bus)
+	games.SetStore(store)
+	server := NewServer(bus, []Handler{games})
+
+	ready := func() int {
+		recorder := httptest.NewRecorder()
+		server.ServeReady(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		return recorder.Code
+	}
+
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected ready, got %v", code)
+	}
+
+	os.RemoveAll(dir)
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected storage going away to fail readiness, got %v", code)
+	}
+
+	os.MkdirAll(dir, 0755)
+	server.Shutdown(context.Background())
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected shutdown to fail readiness, got %v", code)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHealth(recorder, httptest.NewRequest("GET", "/healthz", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected server to stay healthy, got %v", recorder.Code)
+	}
+}
+
+func TestServeVersion(t *testing.T) {
+	server := NewServer(NewBus(), []Handler{})
+
+	recorder := httptest.NewRecorder()
+	server.ServeVersion(recorder, httptest.NewRequest("GET", "/version", nil))
+
+	var version VersionResponse
+	json.Unmarshal(recorder.Body.Bytes(), &version)
+
+	if version.Version != Version || version.Go == "" {
+		t.Errorf("Expected build version, got %+v", version)
+	}
+}
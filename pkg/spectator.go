@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"sync"
+)
+
+// Amount of responses kept for a spectator before new ones are dropped
+const SPECTATOR_BUFFER = 64
+
+// Spectator relays game events to a watching player without
+// making the game wait on slow readers, those who missed some
+// are caught up with the game's state through resync
+type Spectator struct {
+	Player *Player
+
+	closed   bool
+	behind   bool
+	resync   func(*Spectator)
+	detach   func()
+	mutex    *sync.Mutex
+	outgoing chan Response
+}
+
+func NewSpectator(player *Player, resync func(*Spectator)) *Spectator {
+	spectator := &Spectator{
+		Player: player,
+
+		resync:   resync,
+		mutex:    new(sync.Mutex),
+		outgoing: make(chan Response, SPECTATOR_BUFFER),
+	}
+
+	// nothing may go to the player once its channels are closed
+	spectator.detach = player.OnClose(spectator.Close)
+
+	go spectator.Write()
+
+	return spectator
+}
+
+// Queue response to spectator, dropping it if the buffer is full
+func (s *Spectator) Send(response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.outgoing <- response:
+	default: // slow reader
+		s.behind = true
+	}
+}
+
+// Whether responses were dropped since the last resync
+func (s *Spectator) IsBehind() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.behind
+}
+
+// Replace what's queued with state, which has to be taken while
+// no move can go out
+func (s *Spectator) Resync(state Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	for len(s.outgoing) > 0 {
+		<-s.outgoing
+	}
+
+	s.behind = false
+	s.outgoing <- state
+}
+
+func (s *Spectator) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.outgoing)
+		s.detach()
+	}
+}
+
+// Write queued responses to player
+func (s *Spectator) Write() {
+	for response := range s.outgoing {
+		// the player may close while a response is on its way
+		if !notify(s.Player, response) {
+			s.Close()
+			continue
+		}
+
+		if s.IsBehind() {
+			s.resync(s)
+		}
+	}
+}
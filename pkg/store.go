@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SeatRecord struct {
+	Id     uuid.UUID `json:"id"`
+	Rating int       `json:"rating"`
+	Token  string    `json:"token"`
+
+	// clock of games suspended on shutdown
+	Left time.Duration `json:"left"`
+}
+
+// Everything needed to bring a game back after a restart
+type GameRecord struct {
+	Id          uuid.UUID   `json:"id"`
+	White       SeatRecord  `json:"white"`
+	Black       SeatRecord  `json:"black"`
+	TimeControl TimeControl `json:"time_control"`
+	Rank        string      `json:"rank"`
+	Moves       []string    `json:"moves"`
+	Deadline    time.Time   `json:"deadline"`
+	StartedAt   time.Time   `json:"started_at"`
+	Chat        []ChatLine  `json:"chat"`
+}
+
+type GameStore interface {
+	Save(record GameRecord) error
+	Delete(gameId uuid.UUID) error
+	Load() ([]GameRecord, error)
+}
+
+// Keeps each game in a JSON file of its own
+type FileStore struct {
+	dir   string
+	mutex *sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir:   dir,
+		mutex: new(sync.Mutex),
+	}, nil
+}
+
+func (f *FileStore) path(gameId uuid.UUID) string {
+	return filepath.Join(f.dir, gameId.String()+".json")
+}
+
+// Write to a temporary file first so a crash never leaves half a game
+func (f *FileStore) Save(record GameRecord) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path(record.Id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path(record.Id))
+}
+
+func (f *FileStore) Delete(gameId uuid.UUID) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err := os.Remove(f.path(gameId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (f *FileStore) Load() ([]GameRecord, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []GameRecord{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(f.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var record GameRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Make sure games can still be written, e.g. the disk didn't go away
+func (f *FileStore) Check() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	probe, err := os.CreateTemp(f.dir, ".check")
+	if err != nil {
+		return err
+	}
+
+	probe.Close()
+
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := GameRecord{
+		Id:          uuid.New(),
+		White:       SeatRecord{Id: uuid.New(), Rating: 1500, Token: "white"},
+		Black:       SeatRecord{Id: uuid.New(), Rating: 1600, Token: "black"},
+		TimeControl: TimeControl{Days: 3},
+		Rank:        STANDARD_RANK,
+		Moves:       []string{"e2e4", "e7e5"},
+		Deadline:    time.Now().Add(time.Hour).UTC().Round(0),
+		StartedAt:   time.Now().UTC().Round(0),
+		Chat: []ChatLine{
+			{Player: uuid.New(), Channel: PlayersChannel, Text: "gl", Time: time.Now().UTC().Round(0)},
+		},
+	}
+
+	if err := store.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || !reflect.DeepEqual(records[0], record) {
+		t.Errorf("Expected %v, got %v", record, records)
+	}
+
+	if err := store.Delete(record.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if records, _ := store.Load(); len(records) != 0 {
+		t.Errorf("Expected no records, got %v", records)
+	}
+}
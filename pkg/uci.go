@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time given to the engine to answer on top of its move time
+const UCI_TIMEOUT = 5 * time.Second
+
+// UCIEngine talks to an engine binary speaking the Universal
+// Chess Interface through its standard input and output
+type UCIEngine struct {
+	MoveTime time.Duration
+
+	// given to answer on top of MoveTime, UCI_TIMEOUT by default
+	Timeout time.Duration
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+	mutex *sync.Mutex
+}
+
+// Start the engine and wait for it to be ready
+func NewUCIEngine(moveTime time.Duration, command string, args ...string) (*UCIEngine, error) {
+	cmd := exec.Command(command, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	engine := &UCIEngine{
+		MoveTime: moveTime,
+		Timeout:  UCI_TIMEOUT,
+
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan string),
+		mutex: new(sync.Mutex),
+	}
+
+	go engine.Read(stdout)
+
+	for _, handshake := range [][]string{{"uci", "uciok"}, {"isready", "readyok"}} {
+		if _, err := engine.Ask(handshake[0], handshake[1], UCI_TIMEOUT); err != nil {
+			engine.Close()
+			return nil, err
+		}
+	}
+
+	return engine, nil
+}
+
+// Read lines the engine prints until it exits
+func (u *UCIEngine) Read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+
+	for scanner.Scan() {
+		u.lines <- strings.TrimSpace(scanner.Text())
+	}
+
+	close(u.lines)
+}
+
+func (u *UCIEngine) Send(command string) error {
+	_, err := fmt.Fprintln(u.stdin, command)
+	return err
+}
+
+// Send command and wait for a line starting with reply
+func (u *UCIEngine) Ask(command, reply string, timeout time.Duration) (string, error) {
+	if err := u.Send(command); err != nil {
+		return "", err
+	}
+
+	return u.Await(reply, timeout)
+}
+
+// Wait for a line starting with reply, skipping the others
+func (u *UCIEngine) Await(reply string, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case line, ok := <-u.lines:
+			if !ok {
+				return "", errors.New("Engine exited")
+			}
+
+			if strings.HasPrefix(line, reply) {
+				return line, nil
+			}
+		case <-deadline:
+			return "", errors.New("Engine timed out")
+		}
+	}
+}
+
+func (u *UCIEngine) BestMove(position Position) (EngineMove, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if position.Variant == Chess960 {
+		u.Send("setoption name UCI_Chess960 value true")
+	}
+
+	command := "position startpos"
+	if position.Variant == Chess960 {
+		command = "position fen " + uciFen(position)
+	}
+
+	if len(position.Moves) > 0 {
+		command += " moves " + strings.Join(position.Moves, " ")
+	}
+
+	if err := u.Send(command); err != nil {
+		return EngineMove{}, false
+	}
+
+	line, err := u.Ask(
+		fmt.Sprintf("go movetime %d", u.MoveTime.Milliseconds()),
+		"bestmove",
+		u.MoveTime+u.Timeout,
+	)
+	if err != nil {
+		// the late bestmove would answer the next position,
+		// an engine that won't give it up is stuck for good
+		u.Send("stop")
+		if _, err := u.Await("bestmove", u.Timeout); err != nil {
+			u.cmd.Process.Kill()
+		}
+
+		return EngineMove{}, false
+	}
+
+	// bestmove e2e4 [ponder e7e5], or (none) without legal moves
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields[1]) < 4 {
+		return EngineMove{}, false
+	}
+
+	return EngineMove{
+		From: fields[1][0:2],
+		To:   fields[1][2:4],
+	}, true
+}
+
+// Drops and extra win conditions are out of reach of plain UCI
+func (u *UCIEngine) Supports(variant string) bool {
+	return variant == "" || variant == Standard || variant == Chess960
+}
+
+// Ask the engine to quit, killing it if it doesn't
+func (u *UCIEngine) Close() error {
+	u.Send("quit")
+	u.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- u.cmd.Wait()
+	}()
+
+	// keep draining so the engine isn't stuck writing
+	go func() {
+		for range u.lines {
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(UCI_TIMEOUT):
+		return u.cmd.Process.Kill()
+	}
+}
+
+// Starting position in Shredder-FEN, naming the files of the
+// rooks that may castle since Chess960 rooks may be anywhere
+func uciFen(position Position) string {
+	fields := strings.Fields(position.Fen)
+	ranks := strings.Split(fields[0], "/")
+	rank := ranks[len(ranks)-1]
+
+	queenRook := rune('a' + strings.Index(rank, "R"))
+	kingRook := rune('a' + strings.LastIndex(rank, "R"))
+
+	castling := strings.ToUpper(string([]rune{kingRook, queenRook})) + string([]rune{kingRook, queenRook})
+
+	return fmt.Sprintf("%s %s %s - 0 1", fields[0], fields[1], castling)
+}
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Not a real test, runs as a fake UCI engine when the test
+// binary is started by fakeEngine
+func TestFakeUCIEngine(t *testing.T) {
+	if os.Getenv("FAKE_UCI_ENGINE") != "1" {
+		return
+	}
+
+	moves := 0
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// the first search ends late, with whatever comes next
+	stall := os.Getenv("FAKE_UCI_STALL") == "1"
+	stalled := false
+
+	bestMove := func() {
+		fmt.Println("info depth 1 score cp 0")
+		if moves%2 == 0 {
+			fmt.Println("bestmove e2e4 ponder e7e5")
+		} else {
+			fmt.Println("bestmove e7e5")
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if stalled {
+			stalled = false
+			bestMove()
+		}
+
+		switch {
+		case line == "uci":
+			fmt.Println("id name Fake")
+			fmt.Println("uciok")
+		case line == "isready":
+			fmt.Println("readyok")
+		case strings.HasPrefix(line, "position"):
+			moves = 0
+			if parts := strings.SplitN(line, " moves ", 2); len(parts) == 2 {
+				moves = len(strings.Fields(parts[1]))
+			}
+		case strings.HasPrefix(line, "go") && stall:
+			stall = false
+			stalled = true
+		case strings.HasPrefix(line, "go"):
+			bestMove()
+		case line == "quit":
+			os.Exit(0)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func fakeEngine(env ...string) []string {
+	command := append([]string{"env", "FAKE_UCI_ENGINE=1"}, env...)
+	return append(command, os.Args[0], "-test.run=TestFakeUCIEngine")
+}
+
+func TestUCIEngine(t *testing.T) {
+	command := fakeEngine()
+
+	engine, err := NewUCIEngine(100*time.Millisecond, command[0], command[1:]...)
+	if err != nil {
+		t.Fatalf("Expected engine to start, got %v", err)
+	}
+	defer engine.Close()
+
+	move, ok := engine.BestMove(Position{
+		Board: NewBoard(),
+		Color: White,
+	})
+	if !ok || move.From != "e2" || move.To != "e4" {
+		t.Errorf("Expected e2e4, got %+v", move)
+	}
+
+	move, ok = engine.BestMove(Position{
+		Board: NewBoard(),
+		Color: Black,
+		Moves: []string{"e2e4"},
+	})
+	if !ok || move.From != "e7" || move.To != "e5" {
+		t.Errorf("Expected e7e5, got %+v", move)
+	}
+}
+
+func TestUCIEngineTimesOut(t *testing.T) {
+	command := fakeEngine("FAKE_UCI_STALL=1")
+
+	engine, err := NewUCIEngine(100*time.Millisecond, command[0], command[1:]...)
+	if err != nil {
+		t.Fatalf("Expected engine to start, got %v", err)
+	}
+	defer engine.Close()
+
+	engine.Timeout = 100 * time.Millisecond
+
+	if move, ok := engine.BestMove(Position{Board: NewBoard(), Color: White}); ok {
+		t.Fatalf("Expected engine to time out, got %+v", move)
+	}
+
+	// the stopped search doesn't answer the next position
+	move, ok := engine.BestMove(Position{
+		Board: NewBoard(),
+		Color: Black,
+		Moves: []string{"e2e4"},
+	})
+	if !ok || move.From != "e7" || move.To != "e5" {
+		t.Errorf("Expected e7e5, got %+v", move)
+	}
+}
+
+func TestUCIEngineFailsToStart(t *testing.T) {
+	if _, err := NewUCIEngine(time.Second, "false"); err == nil {
+		t.Error("Expected engine that exits to fail")
+	}
+}
+
+func TestUCIFen(t *testing.T) {
+	fen := uciFen(Position{
+		Fen: "nnrkrbbq/pppppppp/8/8/8/8/PPPPPPPP/NNRKRBBQ w - - 0 1",
+	})
+
+	if fen != "nnrkrbbq/pppppppp/8/8/8/8/PPPPPPPP/NNRKRBBQ w ECec - 0 1" {
+		t.Errorf("Expected rook files as castling rights, got %v", fen)
+	}
+}
+
+func TestPlayUCIBot(t *testing.T) {
+	bus := NewBus()
+	events := bus.Listen()
+	manager := NewGameManager(bus)
+	manager.RegisterEngine("fake", fakeEngine()...)
+
+	player := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   PlayBot,
+		Player: player,
+		Payload: map[string]interface{}{
+			"engine": "fake",
+			"color":  "black",
+		},
+	})
+
+	var params MatchParams
+
+	select {
+	case res := <-events:
+		params = res.Payload.(MatchParams)
+	case <-time.After(UCI_TIMEOUT):
+		t.Fatal("Expected game to be created, got timeout")
+	}
+
+	go manager.Process(Message{
+		Type:    CreateGame,
+		Payload: params,
+	})
+
+	<-player.Outgoing // start game
+
+	select {
+	case res := <-events:
+		move := res.Payload.(map[string]interface{})
+		if res.Player != params.Players[0] || move["from"] != "e2" || move["to"] != "e4" {
+			t.Errorf("Expected bot to play e2e4, got %+v", res)
+		}
+	case <-time.After(UCI_TIMEOUT):
+		t.Fatal("Expected bot to move, got timeout")
+	}
+}
+
+func TestPlayUnknownEngine(t *testing.T) {
+	bus := NewBus()
+	manager := NewGameManager(bus)
+	player := NewTestPlayer()
+
+	go manager.Process(Message{
+		Type:   PlayBot,
+		Player: player,
+		Payload: map[string]interface{}{
+			"engine": "stockfish",
+		},
+	})
+
+	if res := <-player.Outgoing; res.Type != Error {
+		t.Errorf("Expected error, got %v", res.Type)
+	}
+}
@@ -0,0 +1,362 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	KingOfTheHill = "kingofthehill"
+	ThreeCheck    = "threecheck"
+	Atomic        = "atomic"
+	Crazyhouse    = "crazyhouse"
+)
+
+// Variant controls the rules that differ from standard chess,
+// each game gets its own instance so variants may keep state
+type Variant interface {
+	Name() string
+
+	// Board with the initial position
+	NewBoard() *Board
+
+	// Whether the piece on from may capture on to
+	AllowsCapture(board *Board, from, to Square) bool
+
+	// Reject moves the regular piece movements allow
+	IsAllowed(board *Board, moves []AllowedMove) bool
+
+	// Called once moves are on the board, captured is the
+	// opponent's piece that stood on the destination
+	AfterMove(board *Board, color Color, moves []AllowedMove, captured Piece)
+
+	// Extra win conditions checked after color moved
+	Winner(board *Board, color Color) (Color, string, bool)
+
+	// Put a piece from color's reserve on the board
+	Drop(board *Board, color Color, notation, to string) error
+
+	// Copy with its own state for boards used to look ahead
+	Clone() Variant
+}
+
+var Variants = map[string]func() Variant{
+	Standard:      func() Variant { return StandardChess{} },
+	Chess960:      func() Variant { return FischerRandom{} },
+	KingOfTheHill: func() Variant { return KingOfTheHillChess{} },
+	ThreeCheck:    func() Variant { return NewThreeCheckChess() },
+	Atomic:        func() Variant { return AtomicChess{} },
+	Crazyhouse:    func() Variant { return NewCrazyhouseChess() },
+}
+
+func IsVariant(name string) bool {
+	_, ok := Variants[name]
+	return name == "" || ok
+}
+
+// Create a variant by name, falling back to standard chess
+func NewVariant(name string) Variant {
+	if create, ok := Variants[name]; ok {
+		return create()
+	}
+	return StandardChess{}
+}
+
+func opponent(color Color) Color {
+	if color == White {
+		return Black
+	}
+	return White
+}
+
+type StandardChess struct{}
+
+func (s StandardChess) Name() string {
+	return Standard
+}
+
+func (s StandardChess) NewBoard() *Board {
+	return NewBoardFromRank(STANDARD_RANK)
+}
+
+func (s StandardChess) AllowsCapture(board *Board, from, to Square) bool {
+	return true
+}
+
+func (s StandardChess) IsAllowed(board *Board, moves []AllowedMove) bool {
+	return true
+}
+
+func (s StandardChess) AfterMove(board *Board, color Color, moves []AllowedMove, captured Piece) {
+}
+
+func (s StandardChess) Winner(board *Board, color Color) (Color, string, bool) {
+	return "", "", false
+}
+
+func (s StandardChess) Drop(board *Board, color Color, notation, to string) error {
+	return errors.New("Drops not allowed")
+}
+
+func (s StandardChess) Clone() Variant {
+	return s
+}
+
+type FischerRandom struct {
+	StandardChess
+}
+
+func (f FischerRandom) Name() string {
+	return Chess960
+}
+
+func (f FischerRandom) NewBoard() *Board {
+	board := NewBoardFromRank(RandomRank())
+	board.variant = f
+	return board
+}
+
+func (f FischerRandom) Clone() Variant {
+	return f
+}
+
+// Win by walking the king to one of the central squares
+type KingOfTheHillChess struct {
+	StandardChess
+}
+
+func (k KingOfTheHillChess) Name() string {
+	return KingOfTheHill
+}
+
+func (k KingOfTheHillChess) NewBoard() *Board {
+	board := NewBoardFromRank(STANDARD_RANK)
+	board.variant = k
+	return board
+}
+
+func (k KingOfTheHillChess) Clone() Variant {
+	return k
+}
+
+func (k KingOfTheHillChess) Winner(board *Board, color Color) (Color, string, bool) {
+	switch board.KingSquare(color) {
+	case "d4", "e4", "d5", "e5":
+		return color, "King of the hill", true
+	}
+	return "", "", false
+}
+
+// Win by checking the opponent three times
+type ThreeCheckChess struct {
+	StandardChess
+	checks map[Color]int
+}
+
+func NewThreeCheckChess() *ThreeCheckChess {
+	return &ThreeCheckChess{
+		checks: make(map[Color]int),
+	}
+}
+
+func (t *ThreeCheckChess) Name() string {
+	return ThreeCheck
+}
+
+func (t *ThreeCheckChess) NewBoard() *Board {
+	board := NewBoardFromRank(STANDARD_RANK)
+	board.variant = t
+	return board
+}
+
+func (t *ThreeCheckChess) Clone() Variant {
+	clone := NewThreeCheckChess()
+	for color, checks := range t.checks {
+		clone.checks[color] = checks
+	}
+	return clone
+}
+
+func (t *ThreeCheckChess) AfterMove(board *Board, color Color, moves []AllowedMove, captured Piece) {
+	king := board.KingSquare(opponent(color))
+
+	if king != "" && len(board.IsThreatened(king, opponent(color))) > 0 {
+		t.checks[color]++
+	}
+}
+
+func (t *ThreeCheckChess) Winner(board *Board, color Color) (Color, string, bool) {
+	if t.checks[color] >= 3 {
+		return color, "Three checks", true
+	}
+	return "", "", false
+}
+
+// Captures blow up every piece but pawns around the
+// destination square, including the capturing piece
+type AtomicChess struct {
+	StandardChess
+}
+
+func (a AtomicChess) Name() string {
+	return Atomic
+}
+
+func (a AtomicChess) NewBoard() *Board {
+	board := NewBoardFromRank(STANDARD_RANK)
+	board.variant = a
+	return board
+}
+
+func (a AtomicChess) Clone() Variant {
+	return a
+}
+
+// Kings can't capture since they'd blow themselves up
+func (a AtomicChess) AllowsCapture(board *Board, from, to Square) bool {
+	return !board.matrix[from.row][from.col].king
+}
+
+// Captures next to the player's own king are suicide
+func (a AtomicChess) IsAllowed(board *Board, moves []AllowedMove) bool {
+	move := moves[0]
+	piece := board.matrix[move.From.row][move.From.col]
+	target := board.matrix[move.To.row][move.To.col]
+
+	if target == Empty() || target.Color == piece.Color {
+		return true
+	}
+
+	for _, square := range surrounding(move.To) {
+		neighbour := board.matrix[square.row][square.col]
+
+		if neighbour.king && neighbour.Color == piece.Color {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a AtomicChess) AfterMove(board *Board, color Color, moves []AllowedMove, captured Piece) {
+	if captured == Empty() {
+		return
+	}
+
+	dest := moves[0].To
+	board.matrix[dest.row][dest.col] = Empty()
+
+	for _, square := range surrounding(dest) {
+		if board.matrix[square.row][square.col].Notation != "p" {
+			board.matrix[square.row][square.col] = Empty()
+		}
+	}
+}
+
+func (a AtomicChess) Winner(board *Board, color Color) (Color, string, bool) {
+	if board.KingSquare(color) == "" {
+		return opponent(color), "Explosion", true
+	}
+	if board.KingSquare(opponent(color)) == "" {
+		return color, "Explosion", true
+	}
+	return "", "", false
+}
+
+// Squares around square that are on the board
+func surrounding(square Square) []Square {
+	squares := []Square{}
+
+	for row := square.row - 1; row <= square.row+1; row++ {
+		for col := square.col - 1; col <= square.col+1; col++ {
+			if row < 0 || row > 7 || col < 'a' || col > 'h' {
+				continue
+			}
+			if row == square.row && col == square.col {
+				continue
+			}
+			squares = append(squares, Square{col: col, row: row})
+		}
+	}
+
+	return squares
+}
+
+// Captured pieces change sides and may be dropped back on the board
+type CrazyhouseChess struct {
+	StandardChess
+	pockets map[Color][]string
+}
+
+func NewCrazyhouseChess() *CrazyhouseChess {
+	return &CrazyhouseChess{
+		pockets: make(map[Color][]string),
+	}
+}
+
+func (c *CrazyhouseChess) Name() string {
+	return Crazyhouse
+}
+
+func (c *CrazyhouseChess) NewBoard() *Board {
+	board := NewBoardFromRank(STANDARD_RANK)
+	board.variant = c
+	return board
+}
+
+func (c *CrazyhouseChess) Clone() Variant {
+	clone := NewCrazyhouseChess()
+	for color := range c.pockets {
+		clone.pockets[color] = c.Pocket(color)
+	}
+	return clone
+}
+
+func (c *CrazyhouseChess) AfterMove(board *Board, color Color, moves []AllowedMove, captured Piece) {
+	if captured != Empty() {
+		c.pockets[color] = append(c.pockets[color], strings.ToUpper(captured.Notation))
+	}
+}
+
+// Pieces color may drop
+func (c *CrazyhouseChess) Pocket(color Color) []string {
+	pocket := make([]string, len(c.pockets[color]))
+	copy(pocket, c.pockets[color])
+
+	return pocket
+}
+
+func (c *CrazyhouseChess) Drop(board *Board, color Color, notation, to string) error {
+	notation = strings.ToUpper(notation)
+	pocket := c.pockets[color]
+
+	index := -1
+	for i, piece := range pocket {
+		if piece == notation {
+			index = i
+			break
+		}
+	}
+
+	if index == -1 {
+		return errors.New("Piece not in pocket")
+	}
+
+	square, err := parseSquare(to)
+	if err != nil {
+		return err
+	}
+
+	if board.matrix[square.row][square.col] != Empty() {
+		return errors.New("Square not empty")
+	}
+
+	if notation == "P" && (square.row == 0 || square.row == 7) {
+		return errors.New("Pawns can't be dropped on the first or last rank")
+	}
+
+	board.matrix[square.row][square.col] = PieceFromNotation(rune(notation[0]), color)
+	c.pockets[color] = append(pocket[:index], pocket[index+1:]...)
+
+	return nil
+}
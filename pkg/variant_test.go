@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"testing"
+)
+
+func TestUnknownVariantFallsBackToStandard(t *testing.T) {
+	if NewVariant("nope").Name() != Standard {
+		t.Error("Expected standard chess")
+	}
+	if IsVariant("nope") {
+		t.Error("Expected unknown variant to be rejected")
+	}
+	if !IsVariant("") || !IsVariant(Atomic) {
+		t.Error("Expected known variants to be accepted")
+	}
+}
+
+func TestKingOfTheHill(t *testing.T) {
+	board := KingOfTheHillChess{}.NewBoard()
+
+	board.matrix[1]['e'] = Empty()
+	board.matrix[0]['e'] = Empty()
+	board.matrix[2]['e'] = King(White)
+
+	if _, _, over := board.Variant().Winner(board, White); over {
+		t.Fatal("Expected game to go on")
+	}
+
+	board.Move("e3", "e4")
+
+	winner, _, over := board.Variant().Winner(board, White)
+	if !over || winner != White {
+		t.Errorf("Expected white to win, got %v", winner)
+	}
+}
+
+func TestThreeCheck(t *testing.T) {
+	board := NewThreeCheckChess().NewBoard()
+	variant := board.Variant()
+
+	board.matrix[6]['f'] = Empty()
+	board.matrix[3]['h'] = Queen(White)
+
+	for i := 0; i < 3; i++ {
+		if _, _, over := variant.Winner(board, White); over {
+			t.Fatalf("Expected game to go on after %v checks", i)
+		}
+
+		// move the queen away and back to give check again
+		board.Move("h4", "h5")
+		board.Move("h5", "h4")
+	}
+
+	winner, reason, over := variant.Winner(board, White)
+	if !over || winner != White || reason != "Three checks" {
+		t.Errorf("Expected white to win by three checks, got %v %v", winner, reason)
+	}
+}
+
+func TestAtomicExplosion(t *testing.T) {
+	board := AtomicChess{}.NewBoard()
+
+	board.matrix[1]['e'] = Empty()
+	board.matrix[4]['d'] = Knight(Black)
+	board.matrix[3]['d'] = Pawn(White)
+
+	board.Move("d1", "e2")
+
+	// queen captures on d5 blowing up the knight and neighbours
+	board.matrix[1]['d'] = Empty()
+	board.matrix[2]['d'] = Empty()
+	board.matrix[3]['d'] = Empty()
+	board.matrix[4]['e'] = Bishop(Black)
+	board.matrix[5]['e'] = Pawn(Black)
+
+	moves := board.Move("e2", "b5")
+	if len(moves) == 0 {
+		t.Fatal("Expected queen to move")
+	}
+
+	board.matrix[4]['c'] = Knight(Black)
+	board.Move("b5", "c5")
+
+	if board.Square("c5") != Empty() {
+		t.Errorf("Expected capturing piece to explode, got %v", board.Square("c5"))
+	}
+	if board.Square("d5") != Empty() {
+		t.Errorf("Expected neighbours to explode, got %v", board.Square("d5"))
+	}
+}
+
+func TestAtomicKingCannotCapture(t *testing.T) {
+	board := AtomicChess{}.NewBoard()
+
+	board.matrix[1]['e'] = Knight(Black)
+
+	if len(board.Move("e1", "e2")) != 0 {
+		t.Error("Expected king not to capture")
+	}
+}
+
+func TestAtomicKingExplodes(t *testing.T) {
+	board := AtomicChess{}.NewBoard()
+
+	board.matrix[6]['f'] = Empty()
+	board.matrix[5]['f'] = Knight(White)
+
+	board.Move("f6", "e8")
+
+	winner, _, over := board.Variant().Winner(board, White)
+	if !over || winner != White {
+		t.Errorf("Expected white to win by explosion, got %v", winner)
+	}
+}
+
+func TestCrazyhouseDrop(t *testing.T) {
+	variant := NewCrazyhouseChess()
+	board := variant.NewBoard()
+
+	board.matrix[2]['d'] = Knight(Black)
+	board.Move("e2", "d3")
+
+	if pocket := variant.Pocket(White); len(pocket) != 1 || pocket[0] != "N" {
+		t.Fatalf("Expected knight in pocket, got %v", pocket)
+	}
+
+	if err := variant.Drop(board, White, "n", "d3"); err == nil {
+		t.Error("Expected drop on occupied square to fail")
+	}
+	if err := variant.Drop(board, White, "q", "e4"); err == nil {
+		t.Error("Expected drop of missing piece to fail")
+	}
+	if err := variant.Drop(board, White, "n", "e4"); err != nil {
+		t.Errorf("Expected drop to succeed, got %v", err)
+	}
+
+	if board.Square("e4") != Knight(White) {
+		t.Errorf("Expected white knight on e4, got %v", board.Square("e4"))
+	}
+	if len(variant.Pocket(White)) != 0 {
+		t.Error("Expected pocket to be empty")
+	}
+}
+
+func TestStandardRejectsDrops(t *testing.T) {
+	board := NewBoard()
+
+	if err := board.Variant().Drop(board, White, "n", "e4"); err == nil {
+		t.Error("Expected drops not to be allowed")
+	}
+}